@@ -2,3 +2,7 @@ module emcc-sandboxd
 
 go 1.25
 
+require (
+	github.com/BurntSushi/toml v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -1,19 +1,47 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	"emcc-sandboxd/src"
 )
 
 func main() {
-	// Optional config.json in working directory
-	cfg, err := src.LoadConfig("config.json")
+	// Helper mode used to start compilers under Landlock; see src.SandboxExec
+	if len(os.Args) > 2 && os.Args[1] == src.SandboxExecArg && os.Args[2] == "--" {
+		os.Exit(src.SandboxExec(os.Args[3:]))
+	}
+	// Helper mode used to start compilers at compileNice/compileIOClass; see src.PriorityExec
+	if len(os.Args) > 1 && os.Args[1] == src.PriorityExecArg {
+		os.Exit(src.PriorityExec(os.Args[2:]))
+	}
+	// Helper mode forwarding a jailed job's proxy connections; see src.NetRelay
+	if len(os.Args) > 1 && os.Args[1] == src.NetRelayArg {
+		os.Exit(src.NetRelay(os.Args[2:]))
+	}
+	checkOnly := flag.Bool("check-config", false, "validate the config file, print the effective configuration and exit")
+	once := flag.Bool("once", false, "compile one request without starting the server: a compile request JSON from stdin, or a source file followed by compiler args")
+	flag.Parse()
+	if *checkOnly {
+		os.Exit(checkConfig(src.FindConfigFile()))
+	}
+
+	// Optional config.json (or config.yaml / config.toml) in working directory
+	cfg, err := src.LoadConfig(src.FindConfigFile())
 	if err != nil {
 		log.Fatalf("load config: %v", err)
 	}
@@ -26,6 +54,9 @@ func main() {
 		log.Printf("Changed working directory to: %s", cfg.WorkingDir)
 	}
 
+	if problems := src.ValidateConfig(cfg); len(problems) > 0 {
+		log.Fatalf("invalid config: %s", strings.Join(problems, "; "))
+	}
 	// Validate minimal external deps when nsjail enabled
 	if cfg.NsJailEnabled {
 		if _, err := exec.LookPath(cfg.NsJailPath); err != nil {
@@ -36,9 +67,61 @@ func main() {
 		log.Fatalf("invalid dirs: %v", err)
 	}
 	srv := src.NewServer(cfg)
-	ctx, cancel := context.WithCancel(context.Background())
+	if *once {
+		os.Exit(compileOnce(srv, flag.Args()))
+	}
+	// Shut down gracefully on SIGINT/SIGTERM (e.g. systemctl stop)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 	if err := srv.Start(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("server: %v", err)
 	}
 }
+
+// compileOnce performs a single compile and prints the compile response, returning
+// the exit code. With a source file argument the request is built from it, the
+// type following the extension and any further arguments being compiler args.
+func compileOnce(srv *src.Server, args []string) int {
+	var body io.Reader = os.Stdin
+	if len(args) > 0 {
+		code, err := os.ReadFile(args[0])
+		if err != nil {
+			log.Print(err)
+			return 2
+		}
+		typ := "cpp"
+		if strings.EqualFold(filepath.Ext(args[0]), ".c") {
+			typ = "c"
+		}
+		b, _ := json.Marshal(src.CompileRequest{Code: string(code), Type: typ, Args: args[1:]})
+		body = bytes.NewReader(b)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if !srv.CompileOnce(ctx, body, os.Stdout) {
+		return 1
+	}
+	return 0
+}
+
+// checkConfig prints the effective configuration and any problems, returning the exit code
+func checkConfig(path string) int {
+	cfg, problems := src.CheckConfig(path)
+	if cfg.NsJailEnabled {
+		if _, err := exec.LookPath(cfg.NsJailPath); err != nil {
+			problems = append(problems, fmt.Sprintf("nsjail enabled but not found at '%s'", cfg.NsJailPath))
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false) // keep "<set>" readable
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(cfg.Redacted())
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "config: %s\n", p)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "config OK")
+	return 0
+}
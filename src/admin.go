@@ -0,0 +1,111 @@
+package src
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// withAdmin only lets requests bearing adminToken, or an OIDC token with
+// oidcAdminRole, through; admin routes are not registered at all without either
+func (s *Server) withAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			writeUnauthorized(w)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isAdmin reports whether r bears adminToken or an OIDC token granting oidcAdminRole
+func (s *Server) isAdmin(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && s.cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) == 1 {
+		return true
+	}
+	c, ok := s.oidcClaims(r)
+	return ok && slices.Contains(c.Roles, s.cfg.OIDCAdminRole)
+}
+
+// adminEnabled reports whether admin endpoints are served, which needs a way to
+// authenticate admins
+func (s *Server) adminEnabled() bool {
+	return s.cfg.AdminToken != "" || s.cfg.OIDCIssuer != ""
+}
+
+// writeUnauthorized asks for adminToken
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="emcc-sandboxd admin"`)
+	writeError(w, http.StatusUnauthorized, codeUnauthorized, "", "unauthorized")
+}
+
+// handleAdminStats reports in-flight jobs, whether the instance drains, and compiler cache statistics
+func (s *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	inflight, _, _ := s.recentOutcomes()
+	stats := AdminStats{InflightJobs: inflight, Draining: s.draining.Load()}
+	s.selftestMu.Lock()
+	stats.Selftest = s.lastSelftest
+	s.selftestMu.Unlock()
+	if s.cfg.CcacheDir != "" {
+		cs, err := s.ccacheStats(r.Context())
+		if err != nil {
+			writeInternalError(w, fmt.Errorf("ccache stats: %w", err))
+			return
+		}
+		stats.Ccache = cs
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+// handleMetrics exposes service metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	inflight, _, _ := s.recentOutcomes()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP emcc_sandboxd_inflight_jobs Compile and analyze requests being handled.\n")
+	fmt.Fprintf(w, "# TYPE emcc_sandboxd_inflight_jobs gauge\n")
+	fmt.Fprintf(w, "emcc_sandboxd_inflight_jobs %d\n", inflight)
+	if s.cfg.CcacheDir == "" {
+		return
+	}
+	cs, err := s.ccacheStats(r.Context())
+	if err != nil {
+		// keep the other metrics scrapeable
+		log.Printf("metrics: ccache stats: %v", err)
+		return
+	}
+	fmt.Fprintf(w, "# HELP emcc_sandboxd_ccache_hits_total Compiler cache hits.\n")
+	fmt.Fprintf(w, "# TYPE emcc_sandboxd_ccache_hits_total counter\n")
+	fmt.Fprintf(w, "emcc_sandboxd_ccache_hits_total %d\n", cs.Hits)
+	fmt.Fprintf(w, "# HELP emcc_sandboxd_ccache_misses_total Compiler cache misses.\n")
+	fmt.Fprintf(w, "# TYPE emcc_sandboxd_ccache_misses_total counter\n")
+	fmt.Fprintf(w, "emcc_sandboxd_ccache_misses_total %d\n", cs.Misses)
+}
+
+// handleAdminDrain starts draining the instance for a rolling upgrade: readiness
+// fails and new jobs are refused at once, and after drainDelaySecs, long enough for
+// load balancers to notice, the server shuts down once running jobs have finished
+func (s *Server) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if s.draining.CompareAndSwap(false, true) {
+		log.Printf("draining: refusing new jobs, stopping in %ds", s.cfg.DrainDelaySecs)
+		time.AfterFunc(time.Duration(s.cfg.DrainDelaySecs)*time.Second, func() { close(s.drained) })
+	}
+	inflight, _, _ := s.recentOutcomes()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(AdminStats{InflightJobs: inflight, Draining: true})
+}
@@ -0,0 +1,136 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// alertCheckInterval is how often the alert monitor samples service health
+const alertCheckInterval = time.Minute
+
+// nsjailFailureExitCode is the status nsjail exits with when it cannot set up the sandbox
+const nsjailFailureExitCode = 255
+
+// alerter rate-limits operational alerts per event
+type alerter struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// alert logs an operational event and delivers it to the configured sinks;
+// repeats of the same event within alertMinIntervalMins are dropped
+func (s *Server) alert(event, format string, args ...any) {
+	interval := time.Duration(s.cfg.AlertMinIntervalMins) * time.Minute
+	s.alerts.mu.Lock()
+	if last, ok := s.alerts.last[event]; ok && time.Since(last) < interval {
+		s.alerts.mu.Unlock()
+		return
+	}
+	if s.alerts.last == nil {
+		s.alerts.last = make(map[string]time.Time)
+	}
+	s.alerts.last[event] = time.Now()
+	s.alerts.mu.Unlock()
+
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("alert %s: %s", event, msg)
+	go s.deliverAlert(event, msg)
+}
+
+// deliverAlert posts an alert to the generic webhook and Slack, whichever are set
+func (s *Server) deliverAlert(event, msg string) {
+	host, _ := os.Hostname()
+	if s.cfg.AlertWebhookURL != "" {
+		postAlert(s.cfg.AlertWebhookURL, map[string]string{
+			"event":   event,
+			"message": msg,
+			"host":    host,
+			"time":    time.Now().UTC().Format(time.RFC3339),
+		})
+	}
+	if s.cfg.AlertSlackWebhookURL != "" {
+		// Slack incoming webhooks take a plain text payload
+		postAlert(s.cfg.AlertSlackWebhookURL, map[string]string{
+			"text": fmt.Sprintf("emcc-sandboxd on %s: *%s* %s", host, event, msg),
+		})
+	}
+}
+
+// postAlert sends one JSON alert payload; failures are only logged
+func postAlert(url string, payload any) {
+	body, _ := json.Marshal(payload)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("alert delivery: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("alert delivery: %s returned %s", url, resp.Status)
+	}
+}
+
+// startAlertMonitor periodically checks the compile failure rate and free disk space
+func (s *Server) startAlertMonitor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(alertCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			s.checkFailureRate()
+			s.checkDiskSpace()
+		}
+	}()
+}
+
+// checkFailureRate alerts when server errors exceed alertMaxFailureRate over the shed window
+func (s *Server) checkFailureRate() {
+	_, failed, samples := s.recentOutcomes()
+	if s.cfg.AlertMaxFailureRate <= 0 || samples < minShedSamples {
+		return
+	}
+	if rate := float64(failed) / float64(samples); rate > s.cfg.AlertMaxFailureRate {
+		s.alert("failure-rate", "%d of %d requests failed with a server error in the last %ds", failed, samples, s.cfg.ShedWindowSecs)
+	}
+}
+
+// checkDiskSpace alerts when the filesystem holding baseDir runs low
+func (s *Server) checkDiskSpace() {
+	if s.cfg.AlertDiskMinFreeMB <= 0 {
+		return
+	}
+	free, err := diskFreeBytes(s.cfg.BaseDir)
+	if err != nil {
+		return
+	}
+	if free < int64(s.cfg.AlertDiskMinFreeMB)*1024*1024 {
+		s.alert("disk-low", "%d MB free under %s", free/(1024*1024), s.cfg.BaseDir)
+	}
+}
+
+// checkSandboxLaunch alerts when a job failed because nsjail itself could not run
+func (s *Server) checkSandboxLaunch(err error) {
+	if !s.cfg.NsJailEnabled || err == nil {
+		return
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		s.alert("nsjail-failure", "starting nsjail: %v", err)
+	} else if exitErr.ExitCode() == nsjailFailureExitCode {
+		s.alert("nsjail-failure", "nsjail could not set up the sandbox (exit status %d)", nsjailFailureExitCode)
+	}
+}
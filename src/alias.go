@@ -0,0 +1,94 @@
+package src
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// aliasPattern restricts artifact aliases to names that read well in URLs; job
+// IDs are excluded so an alias never passes for a build
+var aliasPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// validateAlias checks an alias a compile request asked for
+func validateAlias(name string) error {
+	if !aliasPattern.MatchString(name) || jobIDPattern.MatchString(name) {
+		return fieldErrorf("alias", "alias must be 1 to 63 lowercase letters, digits and '-', and not look like a job id")
+	}
+	return nil
+}
+
+// aliasPath returns where alias name is stored; the file holds the job ID
+func (s *Server) aliasPath(name string) string {
+	return filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactMetaDir, "aliases", name)
+}
+
+// setAlias points alias name at the artifacts of job id, replacing its target
+// atomically, so clients never see it half-updated
+func (s *Server) setAlias(name, id string) error {
+	if err := os.MkdirAll(filepath.Dir(s.aliasPath(name)), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.aliasPath(name), []byte(id), 0o644)
+}
+
+// aliasTarget returns the job alias name points at, while its artifacts exist
+func (s *Server) aliasTarget(name string) (string, bool) {
+	if !aliasPattern.MatchString(name) {
+		return "", false
+	}
+	b, err := os.ReadFile(s.aliasPath(name))
+	if err != nil {
+		return "", false
+	}
+	id := strings.TrimSpace(string(b))
+	return id, s.artifactExists(id)
+}
+
+// aliasURL returns the URL the files of alias name are served under
+func (s *Server) aliasURL(r *http.Request, name string) string {
+	return s.artifactsBaseURL(r) + "/alias/" + name + "/"
+}
+
+// handleAlias serves GET /artifacts/alias/{name}/{file...}, the files of the job
+// an alias currently points at
+func (s *Server) handleAlias(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	id, ok := s.aliasTarget(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no alias "+name)
+		return
+	}
+	s.serveArtifactFile(w, r, id, r.PathValue("file"))
+}
+
+// serveArtifactFile serves file of job id for a name that moves between builds,
+// such as an alias or a channel; the job is reported in X-Job-Id
+func (s *Server) serveArtifactFile(w http.ResponseWriter, r *http.Request, id, file string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w)
+		return
+	}
+	// revalidate, as the name may point at another build by the next request
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Job-Id", id)
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/" + id + "/" + file
+	http.FileServer(http.Dir(filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir))).ServeHTTP(w, r2)
+}
+
+// pruneAliases removes aliases whose artifacts have been cleaned up
+func (s *Server) pruneAliases() {
+	dir := filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactMetaDir, "aliases")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if _, ok := s.aliasTarget(e.Name()); !ok && aliasPattern.MatchString(e.Name()) {
+			_ = os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
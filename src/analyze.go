@@ -0,0 +1,146 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// findingPattern matches clang diagnostics such as
+// main.c:3:5: warning: Value stored to 'x' is never read [clang-analyzer-deadcode.DeadStores]
+var findingPattern = regexp.MustCompile(`^(.+?):(\d+):(\d+): (warning|error|note): (.*?)(?: \[([^\]]+)\])?$`)
+
+// HandleAnalyze runs clang-tidy against the submitted code and returns structured findings
+func (s *Server) HandleAnalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if err := s.ensureDirs(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	var req AnalyzeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if s.writeTooLarge(w, err) {
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, "", "invalid JSON")
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		writeError(w, http.StatusBadRequest, codeMissingField, "code", "code is required")
+		return
+	}
+	lang, ok := parseLang(req.Type)
+	if !ok {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "type", "type must be 'c' or 'cpp'")
+		return
+	}
+	if err := s.checkSourcePaths(req.Code); err != nil {
+		writeFieldError(w, err, "code")
+		return
+	}
+	if err := s.scanSource(r.Context(), req.Code); err != nil {
+		writeScanError(w, err)
+		return
+	}
+
+	queueStart := time.Now()
+	release, ok := s.admitJob(w, r, 1)
+	if !ok {
+		return
+	}
+	defer release()
+	queued := time.Since(queueStart)
+
+	id, _ := randomID(4) // 8 hex chars
+	jobDir, err := s.newJobDir(id, lang, req.Code)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	// Analysis produces no artifacts; the workspace can always go
+	defer s.removeJobDir(jobDir)
+
+	srcName := sourceName(lang)
+	argv := []string{s.cfg.ClangTidyPath, srcName, "--quiet"}
+	if s.cfg.ClangTidyChecks != "" {
+		argv = append(argv, "-checks="+s.cfg.ClangTidyChecks)
+	}
+	// Everything after -- is passed to clang; analyze as emscripten would compile
+	argv = append(argv, "--", "--target=wasm32-unknown-emscripten")
+	if s.cfg.EmscriptenSysroot != "" {
+		argv = append(argv, "--sysroot="+s.cfg.EmscriptenSysroot)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.compileTimeout())
+	defer cancel()
+	cmd, err := s.compileCommand(ctx, jobDir, argv, false)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	// clang-tidy prints findings on stdout and exits non-zero on errors
+	runStart := time.Now()
+	res, runErr := s.runLogged(cmd, nil)
+	// findings are on stdout, errors such as unknown flags on stderr
+	out := res.combined()
+	s.checkSandboxLaunch(runErr)
+	setServerTiming(w, queued, time.Since(runStart))
+
+	resp := AnalyzeResponse{OK: runErr == nil, ID: id, TraceID: traceID(r.Context()), Findings: parseFindings(string(out), srcName)}
+	if runErr != nil && len(resp.Findings) == 0 {
+		resp.Error = string(out)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// parseFindings extracts diagnostics about the submitted source from clang-tidy output
+func parseFindings(out, srcName string) []Finding {
+	findings := []Finding{}
+	for _, line := range strings.Split(out, "\n") {
+		m := findingPattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		// skip diagnostics raised inside system headers
+		if m[1] != srcName && !strings.HasSuffix(m[1], "/"+srcName) {
+			continue
+		}
+		ln, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		findings = append(findings, Finding{
+			Line:     ln,
+			Column:   col,
+			Severity: m[4],
+			Message:  m[5],
+			Check:    m[6],
+		})
+	}
+	return findings
+}
+
+// countDiagnostics tallies the warnings and errors clang reported in compiler output
+func countDiagnostics(out string) DiagnosticCounts {
+	var c DiagnosticCounts
+	for _, line := range strings.Split(out, "\n") {
+		m := findingPattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		switch m[4] {
+		case "warning":
+			c.Warnings++
+		case "error":
+			c.Errors++
+		}
+	}
+	return c
+}
@@ -0,0 +1,82 @@
+package src
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// hostMachines maps GOARCH to the ELF machine of binaries that run natively on it
+var hostMachines = map[string]elf.Machine{
+	"amd64":   elf.EM_X86_64,
+	"386":     elf.EM_386,
+	"arm64":   elf.EM_AARCH64,
+	"arm":     elf.EM_ARM,
+	"riscv64": elf.EM_RISCV,
+	"ppc64le": elf.EM_PPC64,
+	"s390x":   elf.EM_S390,
+}
+
+// toolchainBinaries returns the node, python and LLVM executables emcc runs, by
+// name; ones that cannot be found are left out, as emcc reports those itself
+func (s *Server) toolchainBinaries() map[string]string {
+	bins := make(map[string]string)
+	for name, configured := range map[string]string{"node": s.cfg.NodePath, "python3": s.cfg.PythonPath} {
+		if configured != "" {
+			bins[name] = configured
+		} else if p, err := exec.LookPath(name); err == nil {
+			bins[name] = p
+		}
+	}
+	// emsdk keeps LLVM in upstream/bin, next to upstream/emscripten/emcc
+	llvmDir := ""
+	if s.cfg.EmsdkPath != "" {
+		llvmDir = filepath.Join(s.cfg.EmsdkPath, "upstream", "bin")
+	} else if p, err := exec.LookPath(s.compilerC[0]); err == nil {
+		if p, err = filepath.EvalSymlinks(p); err == nil {
+			llvmDir = filepath.Join(filepath.Dir(p), "..", "bin")
+		}
+	}
+	if llvmDir != "" {
+		for _, name := range []string{"clang", "wasm-ld"} {
+			if p := filepath.Join(llvmDir, name); fileExists(p) {
+				bins[name] = p
+			}
+		}
+	}
+	return bins
+}
+
+// checkToolchainArch reports the toolchain binaries built for another architecture
+// than the host's, which otherwise fail every compile with an exec format error or
+// run slowly under emulation. Scripts and non-ELF binaries are not checked.
+func (s *Server) checkToolchainArch() []string {
+	want, ok := hostMachines[runtime.GOARCH]
+	if !ok || runtime.GOOS != "linux" {
+		return nil
+	}
+	var problems []string
+	for name, p := range s.toolchainBinaries() {
+		f, err := elf.Open(p)
+		if err != nil {
+			continue
+		}
+		got := f.Machine
+		_ = f.Close()
+		if got != want {
+			problems = append(problems, fmt.Sprintf("%s (%s) is built for %s, but the host is %s", name, p, got, runtime.GOARCH))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// fileExists reports whether p names an existing file
+func fileExists(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && !fi.IsDir()
+}
@@ -1,12 +1,28 @@
 package src
 
-import "strings"
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
 
 // MergeAndFilterArgs merges default args with user args, filtering by whitelist
 func (s *Server) MergeAndFilterArgs(user []string) []string {
-	// Start with defaults (already safe)
-	result := append([]string{}, s.cfg.DefaultArgs...)
+	args, _ := s.filterArgs(user)
+	return args
+}
+
+// argPolicy is the allowlist and blocklist of user args, derived from the config
+// once rather than for every request
+type argPolicy struct {
+	allowed, blocked []string
+}
 
+// newArgPolicy builds the arg lists cfg implies
+func newArgPolicy(cfg Config) argPolicy {
 	// Allowlist patterns
 	allowedPrefix := []string{
 		"-O0", "-O1", "-O2", "-O3", "-Os", "-Oz",
@@ -21,13 +37,30 @@ func (s *Server) MergeAndFilterArgs(user []string) []string {
 		"--embed-file",
 		"--source-map-base",
 	}
+	if cfg.AllowDynamicLinking {
+		allowedPrefix = append(allowedPrefix, "-sSIDE_MODULE=", "-sMAIN_MODULE=")
+	}
+	// Target feature flags may also be switched off with -mno-<feature>
+	for _, f := range cfg.AllowedFeatureFlags {
+		allowedPrefix = append(allowedPrefix, f, "-mno-"+strings.TrimPrefix(f, "-m"))
+	}
 	// Disallowed exact/prefixes
 	blocked := []string{
 		"-o",
 		"--shell-file",
 		"-sFORCE_FILESYSTEM",
-		"-sENVIRONMENT=node",
+		// names a file to write, which separateDebug sets inside the job directory
+		"-gseparate-dwarf",
 	}
+	return argPolicy{allowed: allowedPrefix, blocked: blocked}
+}
+
+// filterArgs is MergeAndFilterArgs that also reports the user args it dropped and why
+func (s *Server) filterArgs(user []string) ([]string, []RejectedArg) {
+	var rejected []RejectedArg
+	// Start with defaults (already safe), leaving room for the user's and the forced output args
+	result := make([]string, 0, len(s.cfg.DefaultArgs)+len(user)+8)
+	result = append(result, s.cfg.DefaultArgs...)
 
 	// Normalize and filter
 	for i := 0; i < len(user); i++ {
@@ -39,6 +72,7 @@ func (s *Server) MergeAndFilterArgs(user []string) []string {
 		if (a == "--preload-file" || a == "--embed-file" || a == "--source-map-base") && i+1 < len(user) {
 			next := strings.TrimSpace(user[i+1])
 			if !safeArgPath(next) {
+				rejected = append(rejected, RejectedArg{Arg: a + " " + next, Reason: "path must be relative and stay inside the job directory"})
 				i++ // skip paired next
 				continue
 			}
@@ -47,14 +81,119 @@ func (s *Server) MergeAndFilterArgs(user []string) []string {
 			continue
 		}
 
-		if isBlockedArg(a, blocked) {
+		// --closure takes its level as a separate arg or after =; a bare trailing
+		// --closure would take the forced -o as its level
+		if _, ok := s.cfg.HeavyArgs["--closure"]; ok && (a == "--closure" || strings.HasPrefix(a, "--closure=")) {
+			if level, ok := strings.CutPrefix(a, "--closure="); ok {
+				if !closureLevel(level) {
+					rejected = append(rejected, RejectedArg{Arg: a, Reason: "closure level must be 0, 1 or 2"})
+					continue
+				}
+				result = append(result, a)
+				continue
+			}
+			if i+1 == len(user) {
+				rejected = append(rejected, RejectedArg{Arg: a, Reason: "closure level must follow --closure"})
+				continue
+			}
+			next := strings.TrimSpace(user[i+1])
+			if !closureLevel(next) {
+				rejected = append(rejected, RejectedArg{Arg: a + " " + next, Reason: "closure level must be 0, 1 or 2"})
+				i++
+				continue
+			}
+			result = append(result, a, next)
+			i++
 			continue
 		}
-		if isAllowedArg(a, allowedPrefix) {
+
+		// ports are allowed by name, from the table missingPorts checks the cache against
+		if isPort, valid := checkPortArg(a); isPort {
+			if !valid {
+				rejected = append(rejected, RejectedArg{Arg: a, Reason: "unknown port or value"})
+				continue
+			}
 			result = append(result, a)
+			continue
+		}
+		if isBlockedArg(a, s.args.blocked) || (!s.cfg.AllowNodeEnvironment && targetsNode(a)) {
+			rejected = append(rejected, RejectedArg{Arg: a, Reason: "blocked"})
+			continue
 		}
+		if !isAllowedArg(a, s.args.allowed) && !s.isHeavyArg(a) {
+			rejected = append(rejected, RejectedArg{Arg: a, Reason: "not in the allowlist"})
+			continue
+		}
+		result = append(result, a)
+	}
+	return result, rejected
+}
+
+// defaultHeavyArgs are the link-time optimizations allowed by default, with the
+// resources they need
+func defaultHeavyArgs() map[string]*HeavyArg {
+	return map[string]*HeavyArg{
+		"-flto":         {TimeoutSecs: 600, MemoryMultiplier: 2},
+		"-sEVAL_CTORS=": {TimeoutSecs: 600, MemoryMultiplier: 1.5},
+		// closure compiler runs on the JVM
+		"--closure": {TimeoutSecs: 900, MemoryMultiplier: 3},
 	}
-	return result
+}
+
+// heavyCost returns the timeout and the memory estimate multiplier a compile with
+// args is granted: the largest of those of the heavy args among them, and never
+// less than compileTimeoutSecs and 1
+func (s *Server) heavyCost(args []string) (time.Duration, float64) {
+	timeout, scale := s.compileTimeout(), 1.0
+	for _, a := range args {
+		for flag, h := range s.cfg.HeavyArgs {
+			if !heavyArgMatch(a, flag) {
+				continue
+			}
+			if t := time.Duration(h.TimeoutSecs) * time.Second; t > timeout {
+				timeout = t
+			}
+			scale = max(scale, h.MemoryMultiplier)
+		}
+	}
+	return timeout, scale
+}
+
+// isHeavyArg reports whether a is one of the configured heavy args
+func (s *Server) isHeavyArg(a string) bool {
+	for flag := range s.cfg.HeavyArgs {
+		if heavyArgMatch(a, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// heavyArgMatch reports whether a is flag, or flag with a value; unlike the
+// allowlist prefixes, -flto does not admit -fltofoo nor --closure --closure-args
+func heavyArgMatch(a, flag string) bool {
+	rest, ok := strings.CutPrefix(a, flag)
+	return ok && (rest == "" || strings.HasSuffix(flag, "=") || rest[0] == '=')
+}
+
+// closureLevel reports whether v is a valid --closure level
+func closureLevel(v string) bool {
+	return v == "0" || v == "1" || v == "2"
+}
+
+// targetsNode reports whether a is an -sENVIRONMENT setting that includes node,
+// alone or in a list such as web,node
+func targetsNode(a string) bool {
+	v, ok := strings.CutPrefix(a, "-sENVIRONMENT=")
+	if !ok {
+		return false
+	}
+	for _, env := range strings.Split(v, ",") {
+		if strings.TrimSpace(env) == "node" {
+			return true
+		}
+	}
+	return false
 }
 
 // isBlockedArg checks if an argument is in the blocked list
@@ -80,12 +219,117 @@ func isAllowedArg(a string, allowed []string) bool {
 
 // safeArgPath validates that a path argument is safe
 func safeArgPath(p string) bool {
-	// Deny absolute paths and parent escapes
-	if strings.HasPrefix(p, "/") {
+	// Deny absolute paths, including Windows drive (C:\, C:foo), UNC (\\server)
+	// and rooted (\foo) ones, and parent escapes
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
 		return false
 	}
 	if strings.Contains(p, "..") {
 		return false
 	}
 	return true
-}
\ No newline at end of file
+}
+
+// isSideModule reports whether args build a side module, which is emitted as a bare .wasm without JS glue
+func isSideModule(args []string) bool {
+	side := false
+	for _, a := range args {
+		// later flags override earlier ones, as in emcc
+		if v, ok := strings.CutPrefix(a, "-sSIDE_MODULE="); ok {
+			side = v != "0"
+		}
+	}
+	return side
+}
+
+// wasmFeatures returns the target features that the configured -m<feature> flags in args leave enabled
+func (s *Server) wasmFeatures(args []string) []string {
+	known := make(map[string]bool, len(s.cfg.AllowedFeatureFlags))
+	for _, f := range s.cfg.AllowedFeatureFlags {
+		known[strings.TrimPrefix(f, "-m")] = true
+	}
+	enabled := make(map[string]bool)
+	var order []string
+	for _, a := range args {
+		name, ok := strings.CutPrefix(a, "-m")
+		if !ok {
+			continue
+		}
+		on := true
+		if n, ok := strings.CutPrefix(name, "no-"); ok {
+			name, on = n, false
+		}
+		if !known[name] {
+			continue
+		}
+		if on && !enabled[name] {
+			order = append(order, name)
+		}
+		enabled[name] = on
+	}
+	var features []string
+	for _, name := range order {
+		if enabled[name] {
+			features = append(features, name)
+		}
+	}
+	return features
+}
+
+// maxDefines bounds the number of request-scoped preprocessor defines
+const maxDefines = 64
+
+// definePattern matches valid C preprocessor macro names
+var definePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// defineAndIncludeFlags translates request defines and include dirs into -D / -I flags
+func defineAndIncludeFlags(defines map[string]string, includeDirs []string) ([]string, error) {
+	if len(defines) > maxDefines {
+		return nil, fieldErrorf("defines", "at most %d defines are allowed", maxDefines)
+	}
+	var flags []string
+	// map order is random; keep the command line stable
+	names := make([]string, 0, len(defines))
+	for name := range defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !definePattern.MatchString(name) {
+			return nil, fieldErrorf("defines", "invalid define name %q", name)
+		}
+		value := defines[name]
+		if strings.ContainsFunc(value, unicode.IsControl) {
+			return nil, fieldErrorf("defines", "define %s contains control characters", name)
+		}
+		if value == "" {
+			flags = append(flags, "-D"+name)
+		} else {
+			flags = append(flags, "-D"+name+"="+value)
+		}
+	}
+	for _, dir := range includeDirs {
+		dir = strings.TrimSpace(dir)
+		// relative to the job dir, which is the root of the submitted files
+		if dir == "" || !safeArgPath(dir) || strings.HasPrefix(dir, "-") {
+			return nil, fieldErrorf("includeDirs", "invalid include dir %q", dir)
+		}
+		flags = append(flags, "-I"+dir)
+	}
+	return flags, nil
+}
+
+// warningFlags maps the warnings request field to compiler flags
+func warningFlags(level string) ([]string, bool) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "", "default":
+		return nil, true
+	case "none":
+		return []string{"-w"}, true
+	case "all":
+		return []string{"-Wall", "-Wextra"}, true
+	case "error":
+		return []string{"-Wall", "-Wextra", "-Werror"}, true
+	}
+	return nil, false
+}
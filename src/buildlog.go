@@ -0,0 +1,269 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// jobIDPattern matches the IDs randomID gives jobs
+var jobIDPattern = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+// buildLog records a job's compiler output to logsDir/<id>.log, up to buildLogMaxKB
+type buildLog struct {
+	mu      sync.Mutex
+	f       *os.File
+	written int64
+	max     int64
+	wake    chan struct{} // closed when output is appended, then replaced
+}
+
+// buildLogPath returns where the log of job id is kept
+func (s *Server) buildLogPath(id string) string {
+	return filepath.Join(s.cfg.BaseDir, s.cfg.LogsDir, id+".log")
+}
+
+// openBuildLog starts the log of job id and registers it as running, so it can be
+// followed; nil when log retention is disabled or the file cannot be created
+func (s *Server) openBuildLog(id string) *buildLog {
+	if s.cfg.BuildLogMaxKB <= 0 {
+		return nil
+	}
+	f, err := os.OpenFile(s.buildLogPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		// the build goes on without a retained log
+		log.Printf("job %s: build log: %v", id, err)
+		return nil
+	}
+	l := &buildLog{f: f, max: int64(s.cfg.BuildLogMaxKB) * 1024, wake: make(chan struct{})}
+	s.logsMu.Lock()
+	s.runningLogs[id] = l
+	s.logsMu.Unlock()
+	return l
+}
+
+// closeBuildLog finishes the log of job id, waking anyone following it
+func (s *Server) closeBuildLog(id string, l *buildLog) {
+	if l == nil {
+		return
+	}
+	s.logsMu.Lock()
+	delete(s.runningLogs, id)
+	s.logsMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.f.Close()
+	close(l.wake)
+}
+
+// Write appends p to the log, truncating it at the size cap. It never fails, so a
+// full disk cannot fail the build the log belongs to.
+func (l *buildLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.written >= l.max {
+		return len(p), nil
+	}
+	b := p
+	if room := l.max - l.written; int64(len(b)) > room {
+		b = append(b[:room:room], "\n[log truncated]\n"...)
+	}
+	n, _ := l.f.Write(b)
+	l.written += int64(n)
+	close(l.wake)
+	l.wake = make(chan struct{})
+	return len(p), nil
+}
+
+// wakeChan returns the channel closed at the next append to the log
+func (l *buildLog) wakeChan() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.wake
+}
+
+// cmdOutput is what a command wrote, each stream capped at compilerOutputMaxKB
+type cmdOutput struct {
+	stdout, stderr []byte
+}
+
+// combined returns stderr followed by stdout; diagnostics come first
+func (o cmdOutput) combined() []byte {
+	return append(append([]byte{}, o.stderr...), o.stdout...)
+}
+
+// add appends the output of a further command
+func (o *cmdOutput) add(more cmdOutput) {
+	o.stdout = append(o.stdout, more.stdout...)
+	o.stderr = append(o.stderr, more.stderr...)
+}
+
+// outputBufPool recycles the buffers compiler output is captured in, which
+// would otherwise be grown anew for every compile
+var outputBufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// cappedBuffer keeps the first max bytes written to it and counts the rest
+type cappedBuffer struct {
+	buf     *bytes.Buffer
+	max     int
+	dropped int64
+}
+
+// newCappedBuffer returns a cappedBuffer backed by a pooled buffer, which
+// release returns
+func newCappedBuffer(max int) *cappedBuffer {
+	buf := outputBufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return &cappedBuffer{buf: buf, max: max}
+}
+
+// Write never fails, so a flood of output cannot fail the command writing it
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	keep := min(len(p), b.max-b.buf.Len())
+	b.buf.Write(p[:keep])
+	b.dropped += int64(len(p) - keep)
+	return len(p), nil
+}
+
+// bytes returns a copy of what was kept, with a marker if anything was dropped
+func (b *cappedBuffer) bytes(stream string) []byte {
+	out := bytes.Clone(b.buf.Bytes())
+	if b.dropped == 0 {
+		return out
+	}
+	return fmt.Appendf(out, "\n[%s truncated: %d bytes dropped]\n", stream, b.dropped)
+}
+
+// release returns the buffer to the pool; b must not be used afterwards
+func (b *cappedBuffer) release() {
+	outputBufPool.Put(b.buf)
+	b.buf = nil
+}
+
+// PriorityExecArg makes the daemon binary act as the priority-exec helper
+const PriorityExecArg = "-priority-exec"
+
+// withPriority makes cmd start through the priority-exec helper, which applies
+// compileNice and compileIOClass before executing the command, so that no part of
+// it runs at the daemon's priority
+func (s *Server) withPriority(cmd *exec.Cmd) error {
+	if (s.cfg.CompileNice == 0 && s.cfg.CompileIOClass == "") || cmd.Err != nil {
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	helper := []string{self, PriorityExecArg, strconv.Itoa(s.cfg.CompileNice), s.cfg.CompileIOClass, "--", cmd.Path}
+	cmd.Args = append(helper, cmd.Args...)
+	cmd.Path = self
+	return nil
+}
+
+// runLogged runs cmd, capturing stdout and stderr separately up to
+// compilerOutputMaxKB each and copying both to logw if set. Processes cmd left
+// behind in its process group are killed when it returns.
+func (s *Server) runLogged(cmd *exec.Cmd, logw io.Writer) (cmdOutput, error) {
+	defer reapProcessGroup(cmd)
+	max := s.cfg.CompilerOutputMaxKB * 1024
+	stdout, stderr := newCappedBuffer(max), newCappedBuffer(max)
+	defer stdout.release()
+	defer stderr.release()
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if logw != nil {
+		// the log keeps both streams interleaved as the compiler wrote them
+		cmd.Stdout = io.MultiWriter(stdout, logw)
+		cmd.Stderr = io.MultiWriter(stderr, logw)
+	}
+	if perr := s.withPriority(cmd); perr != nil {
+		log.Printf("warning: lowering compiler priority: %v", perr)
+	}
+	err := cmd.Start()
+	if err == nil {
+		err = cmd.Wait()
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// cmd succeeded; only a leftover process still held its output open
+		err = nil
+	}
+	return cmdOutput{stdout: stdout.bytes("stdout"), stderr: stderr.bytes("stderr")}, err
+}
+
+// handleJobLog serves GET /jobs/{id}/log, the retained compiler output of a job.
+// With ?follow=1 the response stays open and streams output until a running job finishes.
+func (s *Server) handleJobLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	id := r.PathValue("id")
+	if !jobIDPattern.MatchString(id) {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "id", "invalid job id")
+		return
+	}
+	f, err := os.Open(s.buildLogPath(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no log for job "+id)
+		return
+	}
+	defer f.Close()
+	follow := r.URL.Query().Get("follow") == "1"
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	rc := http.NewResponseController(w)
+	for {
+		// Take the wake channel before copying so no append in between is missed
+		s.logsMu.Lock()
+		l := s.runningLogs[id]
+		s.logsMu.Unlock()
+		var wake <-chan struct{}
+		if l != nil {
+			wake = l.wakeChan()
+		}
+		if _, err := io.Copy(w, f); err != nil {
+			return
+		}
+		if !follow || l == nil {
+			return
+		}
+		_ = rc.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		}
+	}
+}
+
+// pruneBuildLogs removes logs older than buildLogTTLHours
+func (s *Server) pruneBuildLogs() {
+	if s.cfg.BuildLogMaxKB <= 0 {
+		return
+	}
+	dir := filepath.Join(s.cfg.BaseDir, s.cfg.LogsDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		s.alert("cleanup-error", "reading %s: %v", dir, err)
+		return
+	}
+	ttl := time.Duration(s.cfg.BuildLogTTLHours) * time.Hour
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil || !fi.Mode().IsRegular() || time.Since(fi.ModTime()) <= ttl {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			s.alert("cleanup-error", "removing expired build log: %v", err)
+		}
+	}
+}
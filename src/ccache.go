@@ -0,0 +1,97 @@
+package src
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ccacheBinary returns the absolute path of ccachePath, which the sandboxes mount
+// read-only, or "" if it cannot be found
+func (s *Server) ccacheBinary() string {
+	p, err := exec.LookPath(s.cfg.CcachePath)
+	if err != nil {
+		return ""
+	}
+	if p, err = filepath.Abs(p); err != nil {
+		return ""
+	}
+	return p
+}
+
+// compilerWrapped reports whether compilerC and compilerCpp already run through a
+// compiler cache such as "ccache emcc"
+func (s *Server) compilerWrapped() bool {
+	for _, c := range [][]string{s.compilerC, s.compilerCpp} {
+		if name := filepath.Base(c[0]); name != "ccache" && name != "sccache" {
+			return false
+		}
+	}
+	return true
+}
+
+// ccacheEnv returns the CCACHE_* environment of a job whose directory the compiler
+// sees as workDir, with EM_COMPILER_WRAPPER making emcc run clang through ccache
+// unless the compiler command already starts with a cache; empty when no ccache dir
+// is configured
+func (s *Server) ccacheEnv(workDir string) []string {
+	if s.cfg.CcacheDir == "" {
+		return nil
+	}
+	var env []string
+	if bin := s.ccacheBinary(); bin != "" && !s.compilerWrapped() {
+		env = append(env, "EM_COMPILER_WRAPPER="+bin)
+	}
+	env = append(env,
+		"CCACHE_DIR="+s.cfg.CcacheDir,
+		// Paths under the job dir are hashed relative to it, so identical
+		// submissions hit the cache although every job has its own directory
+		"CCACHE_BASEDIR="+workDir,
+		"CCACHE_NOHASHDIR=1",
+		// the cache is shared by every job, whichever user it runs as
+		"CCACHE_UMASK=002",
+	)
+	if s.cfg.PCHDir != "" {
+		// ccache only caches compiles using a precompiled header when told to
+		env = append(env, "CCACHE_SLOPPINESS=pch_defines,time_macros,include_file_mtime")
+	}
+	if s.cfg.CcacheMaxSize != "" {
+		env = append(env, "CCACHE_MAXSIZE="+s.cfg.CcacheMaxSize)
+	}
+	return env
+}
+
+// ccacheStats reads the counters of the shared cache with "ccache --print-stats"
+func (s *Server) ccacheStats(ctx context.Context) (*CcacheStats, error) {
+	cmd := exec.CommandContext(ctx, s.cfg.CcachePath, "--print-stats")
+	cmd.Env = append(os.Environ(), "CCACHE_DIR="+s.cfg.CcacheDir)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	stats := &CcacheStats{Counters: make(map[string]int64)}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		// one "<name>\t<value>" line per counter
+		name, value, ok := strings.Cut(sc.Text(), "\t")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		stats.Counters[name] = n
+	}
+	stats.Hits = stats.Counters["direct_cache_hit"] + stats.Counters["preprocessed_cache_hit"]
+	stats.Misses = stats.Counters["cache_miss"]
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats, nil
+}
@@ -0,0 +1,96 @@
+//go:build linux
+
+package src
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// readCgroupMemoryMax reads the memory.max value from cgroups v2
+func readCgroupMemoryMax(root string) (int64, error) {
+	if root == "" {
+		return 0, fmt.Errorf("cgroup root not set")
+	}
+	b, err := os.ReadFile(filepath.Join(root, "memory.max"))
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "max" {
+		return 0, nil
+	}
+	var v int64
+	_, err = fmt.Sscanf(s, "%d", &v)
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// readCgroupMemoryCurrent reads the memory.current value from cgroups v2
+func readCgroupMemoryCurrent(root string) (int64, error) {
+	b, err := os.ReadFile(filepath.Join(root, "memory.current"))
+	if err != nil {
+		return 0, err
+	}
+	var v int64
+	_, err = fmt.Sscanf(strings.TrimSpace(string(b)), "%d", &v)
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// readCgroupMemoryPressure returns the "some avg10" value of memory.pressure, the
+// percentage of the last 10s in which some task stalled waiting for memory
+func readCgroupMemoryPressure(root string) (float64, error) {
+	b, err := os.ReadFile(filepath.Join(root, "memory.pressure"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(f, "avg10="); ok {
+				return strconv.ParseFloat(v, 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("memory.pressure: no some avg10 value")
+}
+
+// watchCgroupMemoryEvents calls wake whenever memory.events changes, which the
+// kernel signals when the cgroup reaches its high or max limit and reclaims
+func watchCgroupMemoryEvents(root string, wake func()) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Join(root, "memory.events"), syscall.IN_MODIFY); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	// A non-blocking fd is read through the runtime poller rather than a blocked thread
+	f := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		defer f.Close()
+		buf := make([]byte, 4096)
+		for {
+			if _, err := f.Read(buf); err != nil {
+				log.Printf("memory.events watch stopped: %v", err)
+				return
+			}
+			wake()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package src
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// errCgroupUnsupported is returned where cgroups v2 is unavailable
+var errCgroupUnsupported = fmt.Errorf("cgroups v2 is not available on %s", runtime.GOOS)
+
+// readCgroupMemoryMax is unavailable outside Linux
+func readCgroupMemoryMax(root string) (int64, error) {
+	return 0, errCgroupUnsupported
+}
+
+// readCgroupMemoryCurrent is unavailable outside Linux
+func readCgroupMemoryCurrent(root string) (int64, error) {
+	return 0, errCgroupUnsupported
+}
+
+// readCgroupMemoryPressure is unavailable outside Linux
+func readCgroupMemoryPressure(root string) (float64, error) {
+	return 0, errCgroupUnsupported
+}
+
+// watchCgroupMemoryEvents is unavailable outside Linux
+func watchCgroupMemoryEvents(root string, wake func()) error {
+	return errCgroupUnsupported
+}
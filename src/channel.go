@@ -0,0 +1,182 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// channelHistory is how many releases a channel remembers for rollback; the
+// artifacts of all of them are exempt from cleanup
+const channelHistory = 10
+
+// channelPath returns where channel name is stored
+func (s *Server) channelPath(name string) string {
+	return filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactMetaDir, "channels", name+".json")
+}
+
+// readChannel returns the releases of channel name, newest first
+func (s *Server) readChannel(name string) ([]ChannelRelease, error) {
+	b, err := os.ReadFile(s.channelPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var releases []ChannelRelease
+	if err := json.Unmarshal(b, &releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// writeChannel replaces the releases of channel name in one step
+func (s *Server) writeChannel(name string, releases []ChannelRelease) error {
+	if err := os.MkdirAll(filepath.Dir(s.channelPath(name)), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(releases)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.channelPath(name), b, 0o644)
+}
+
+// channelStatus describes channel name for responses
+func (s *Server) channelStatus(r *http.Request, name string, releases []ChannelRelease) ChannelStatus {
+	st := ChannelStatus{Name: name, URL: s.channelURL(r, name), History: releases}
+	if len(releases) > 0 {
+		st.Current = releases[0].ArtifactID
+	}
+	return st
+}
+
+// channelURL returns the URL the current release of channel name is served under
+func (s *Server) channelURL(r *http.Request, name string) string {
+	p := "/channels/" + name + "/"
+	if s.cfg.ArtifactsBaseURL != "" || s.cfg.ArtifactsAddr != "" {
+		return strings.TrimSuffix(s.cfg.ArtifactsBaseURL, "/") + p
+	}
+	return s.publicURL(r, p)
+}
+
+// handleChannel serves GET /admin/channels/{name}, the releases of a channel, and
+// POST, which promotes the artifact given as {"artifactId"} to it
+func (s *Server) handleChannel(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !aliasPattern.MatchString(name) {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "name", "channel names are 1 to 63 lowercase letters, digits and '-'")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		releases, err := s.readChannel(name)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if len(releases) == 0 {
+			writeError(w, http.StatusNotFound, codeNotFound, "", "no channel "+name)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.channelStatus(r, name, releases))
+	case http.MethodPost:
+		var req struct {
+			ArtifactID string `json:"artifactId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidJSON, "", "invalid JSON")
+			return
+		}
+		if !s.artifactExists(req.ArtifactID) {
+			writeError(w, http.StatusBadRequest, codeInvalidField, "artifactId", "no artifact "+req.ArtifactID)
+			return
+		}
+		s.channelMu.Lock()
+		defer s.channelMu.Unlock()
+		releases, err := s.readChannel(name)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		releases = append([]ChannelRelease{{ArtifactID: req.ArtifactID, Promoted: time.Now().UTC()}}, releases...)
+		if len(releases) > channelHistory {
+			releases = releases[:channelHistory]
+		}
+		if err := s.writeChannel(name, releases); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.channelStatus(r, name, releases))
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// handleChannelRollback serves POST /admin/channels/{name}/rollback, which drops
+// the current release so the one before it is served again
+func (s *Server) handleChannelRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	name := r.PathValue("name")
+	s.channelMu.Lock()
+	defer s.channelMu.Unlock()
+	releases, err := s.readChannel(name)
+	if !aliasPattern.MatchString(name) || err != nil || len(releases) == 0 {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no channel "+name)
+		return
+	}
+	if len(releases) < 2 {
+		writeError(w, http.StatusConflict, codeInvalidField, "name", "channel "+name+" has no earlier release")
+		return
+	}
+	releases = releases[1:]
+	if err := s.writeChannel(name, releases); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.channelStatus(r, name, releases))
+}
+
+// handleChannelFile serves GET /channels/{name}/{file...}, the files of the
+// current release of a channel
+func (s *Server) handleChannelFile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var releases []ChannelRelease
+	if aliasPattern.MatchString(name) {
+		releases, _ = s.readChannel(name)
+	}
+	if len(releases) == 0 {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no channel "+name)
+		return
+	}
+	s.serveArtifactFile(w, r, releases[0].ArtifactID, r.PathValue("file"))
+}
+
+// channelArtifacts returns the artifacts of every release channels remember,
+// which cleanup keeps
+func (s *Server) channelArtifacts() map[string]bool {
+	keep := make(map[string]bool)
+	entries, _ := os.ReadDir(filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactMetaDir, "channels"))
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		releases, _ := s.readChannel(name)
+		for _, rel := range releases {
+			keep[rel.ArtifactID] = true
+		}
+	}
+	return keep
+}
@@ -16,24 +16,35 @@ func (s *Server) StartCleanupLoop() {
 	if interval <= 0 {
 		interval = 30 * time.Minute
 	}
-	ttl := s.cfg.ArtifactTTL
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 		for {
+			s.pruneIdempotency()
+			s.pruneBuildLogs()
+			s.pruneShares()
+			s.prunePreviews()
+			s.pruneArtifactMeta()
+			s.pruneAliases()
 			entries, err := os.ReadDir(dir)
-			if err == nil {
-				for _, e := range entries {
-					fi, err := os.Stat(filepath.Join(dir, e.Name()))
-					if err != nil || !fi.IsDir() {
+			if err != nil {
+				s.alert("cleanup-error", "reading %s: %v", dir, err)
+			}
+			released := s.channelArtifacts()
+			for _, e := range entries {
+				fi, err := os.Stat(filepath.Join(dir, e.Name()))
+				if err != nil || !fi.IsDir() || released[e.Name()] {
+					continue
+				}
+				if exp := s.artifactExpiry(e.Name(), fi.ModTime()); !exp.IsZero() && time.Now().After(exp) {
+					if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+						s.alert("cleanup-error", "removing expired artifact: %v", err)
 						continue
 					}
-					if time.Since(fi.ModTime()) > ttl {
-						_ = os.RemoveAll(filepath.Join(dir, e.Name()))
-					}
+					_ = os.Remove(s.artifactMetaPath(e.Name()))
 				}
 			}
 			<-ticker.C
 		}
 	}()
-}
\ No newline at end of file
+}
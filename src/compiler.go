@@ -5,11 +5,16 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
 )
@@ -25,145 +30,497 @@ func randomID(n int) (string, error) {
 
 // HandleCompile handles the compilation request
 func (s *Server) HandleCompile(w http.ResponseWriter, r *http.Request) {
+	events := newJobTimeline()
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 	if err := s.ensureDirs(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 
-	var req CompileRequest
-	dec := json.NewDecoder(r.Body)
-	if err := dec.Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	req, err := decodeCompileRequest(r)
+	if s.writeTooLarge(w, err) {
+		return
+	}
+	if errors.Is(err, errInvalidJSON) || errors.Is(err, errInvalidBody) {
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, "", err.Error())
+		return
+	}
+	if err != nil {
+		writeFieldError(w, err, "")
 		return
 	}
 	if strings.TrimSpace(req.Code) == "" {
-		http.Error(w, "code is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, codeMissingField, "code", "code is required")
 		return
 	}
-	lang := strings.ToLower(strings.TrimSpace(req.Type))
-	if lang != "c" && lang != "cpp" && lang != "cc" && lang != "c++" && lang != "" {
-		http.Error(w, "type must be 'c' or 'cpp'", http.StatusBadRequest)
+	lang, ok := parseLang(req.Type)
+	if !ok {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "type", "type must be 'c' or 'cpp'")
 		return
 	}
-	if lang == "" {
-		// default to c
-		lang = "c"
+	if err := s.checkSourcePaths(req.Code); err != nil {
+		writeFieldError(w, err, "code")
+		return
+	}
+	if err := s.scanSource(r.Context(), req.Code); err != nil {
+		writeScanError(w, err)
+		return
+	}
+	mode, ok := normalizeOutput(req.Output)
+	if !ok {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "output", "output must be one of 'wasm', 'html', 'object', 'staticlib', 'preprocessed', 'asm' or 'llvm-ir'")
+		return
 	}
 
-	// Resource gating by cgroup memory budget if enabled
-	ctx := r.Context()
-	if s.cfg.EnableResourceGating {
-		if err := s.ensureMemBudget(); err != nil {
-			http.Error(w, "resource gating init failed: "+err.Error(), http.StatusInternalServerError)
+	extraFlags, err := defineAndIncludeFlags(req.Defines, req.IncludeDirs)
+	if err != nil {
+		writeFieldError(w, err, "defines")
+		return
+	}
+	warnFlags, ok := warningFlags(req.Warnings)
+	if !ok {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "warnings", "warnings must be one of 'none', 'default', 'all' or 'error'")
+		return
+	}
+	extraFlags = append(extraFlags, warnFlags...)
+	profile, err := s.resolveProfile(req.Profile, req.Args)
+	if err != nil {
+		writeFieldError(w, err, "profile")
+		return
+	}
+	if profile != nil {
+		// after the defaults, so the profile's settings win
+		extraFlags = append(extraFlags, profile.Args...)
+	}
+	if req.Network && s.cfg.NetworkPolicy != networkAllowlist {
+		writeError(w, http.StatusBadRequest, codeFeatureDisabled, "network", "network access is disabled by the network policy")
+		return
+	}
+	if mode == outputHTML && !s.cfg.AllowHTMLOutput {
+		writeError(w, http.StatusBadRequest, codeFeatureDisabled, "output", "html output is disabled")
+		return
+	}
+	switch req.Cache {
+	case "", emCacheShared, emCachePrivate:
+	default:
+		writeError(w, http.StatusBadRequest, codeInvalidField, "cache", "cache must be 'shared' or 'private'")
+		return
+	}
+	ttl, err := s.requestTTL(req.TTLHours)
+	if err != nil {
+		writeFieldError(w, err, "ttlHours")
+		return
+	}
+	if req.Alias != "" {
+		if !s.adminEnabled() || !s.cfg.EnableStaticArtifacts {
+			writeError(w, http.StatusBadRequest, codeFeatureDisabled, "alias", "aliases are disabled")
 			return
 		}
-		est := s.cfg.JobMemoryEstimateMB * 1024 * 1024
-		if est <= 0 {
-			est = 256 * 1024 * 1024
+		if s.roleOf(r) < roleUser {
+			writeUnauthorized(w)
+			return
 		}
-		if err := s.acquireMemory(ctx, est); err != nil {
-			http.Error(w, "resource wait canceled", http.StatusRequestTimeout)
+		if err := validateAlias(req.Alias); err != nil {
+			writeFieldError(w, err, "alias")
 			return
 		}
-		defer s.releaseMemory(est)
 	}
-
-	id, _ := randomID(4) // 8 hex chars
-	jobDir := filepath.Join(s.cfg.BaseDir, s.cfg.JobsDir, id)
-	artDir := filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, id)
-	if err := os.MkdirAll(jobDir, 0o755); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if req.Preview && !s.cfg.AllowPreview {
+		writeError(w, http.StatusBadRequest, codeFeatureDisabled, "preview", "previews are disabled")
 		return
 	}
-	if err := os.MkdirAll(artDir, 0o755); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if req.Preview && mode != outputHTML {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "preview", "preview requires html output")
 		return
 	}
-
-	srcName := "main.c"
-	if lang != "c" {
-		srcName = "main.cpp"
+	wasmBody := wantsWasmBody(r)
+	if wasmBody && mode != outputWasm && mode != outputHTML {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "output", "a wasm response requires wasm output")
+		return
 	}
-	srcPath := filepath.Join(jobDir, srcName)
-	if err := os.WriteFile(srcPath, []byte(req.Code), 0o644); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if req.WAT && mode != outputWasm && mode != outputHTML {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "wat", "wat requires wasm output")
+		return
+	}
+	if req.SeparateDebug && mode != outputWasm && mode != outputHTML {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "separateDebug", "separateDebug requires wasm output")
 		return
 	}
 
 	// Build argument list
-	args := s.MergeAndFilterArgs(req.Args)
+	args, rejected := s.filterArgs(req.Args)
+	timeout, memScale := s.heavyCost(args)
+	// Without network emcc cannot fetch a port it lacks and fails only at the deadline
+	if missing := s.missingPorts(slices.Concat(args, extraFlags)); len(missing) > 0 {
+		if !req.Network {
+			msg := "emscripten ports not preinstalled: " + strings.Join(missing, ", ")
+			if s.cfg.NetworkPolicy == networkAllowlist {
+				msg += `; set "network": true to download them`
+			}
+			writeError(w, http.StatusBadRequest, codePortNotInstalled, "args", msg)
+			return
+		}
+		timeout += time.Duration(s.cfg.PortFetchTimeoutSecs) * time.Second
+	}
+	timeout = s.roleTimeout(r, timeout)
+
+	events.add("queued")
+	queueStart := time.Now()
+	release, ok := s.admitJob(w, r, memScale)
+	if !ok {
+		return
+	}
+	defer release()
+	queued := time.Since(queueStart)
+	events.add("gate-acquired")
+
+	id, _ := randomID(4) // 8 hex chars
+	jobDir, err := s.newJobDir(id, lang, req.Code)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	// Cleanup job dir (best-effort)
+	defer s.removeJobDir(jobDir)
+	if req.Cache == emCachePrivate || s.cfg.EmCacheMode == emCachePrivate {
+		if err := s.newPrivateCache(jobDir); err != nil {
+			writeInternalError(w, fmt.Errorf("private cache: %w", err))
+			return
+		}
+	}
+	artDir := filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, id)
+
+	args = append(args, extraFlags...)
 	// Always force output naming & paths
-	args = append(args, "-o", "app.js")
+	base := s.cfg.OutputName
+	plan := planOutput(mode, args, base)
+	args = append(args, plan.args...)
+	if req.WAT {
+		// wasm2wat and wasm-dis share the "<in> -o <out>" syntax
+		plan.post = append(plan.post, []string{s.cfg.WasmDisassemblerPath, base + ".wasm", "-o", base + ".wat"})
+		plan.files = append(plan.files, base+".wat")
+	}
+	if req.SeparateDebug {
+		// app.wasm keeps only the name of the debug file, which devtools fetch next to it
+		args = append(args, "-g", "-gseparate-dwarf="+base+".debug.wasm")
+		plan.files = append(plan.files, base+".debug.wasm")
+	}
 
-	// Choose compiler
-	compiler := "emcc"
+	// Choose compiler; the command may start with a wrapper such as ccache
+	compiler := s.compilerC
 	if lang != "c" {
-		compiler = "em++"
+		compiler = s.compilerCpp
 	}
+	args = append(args, s.pchArgs(lang, mode, req.Code, args)...)
 
 	// Execute compile
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	// compiler is shared between requests, so argv gets its own array
+	argv := make([]string, 0, len(compiler)+1+len(args))
+	argv = append(append(append(argv, compiler...), sourceName(lang)), args...)
+	buildStart := time.Now()
+	blog := s.openBuildLog(id)
+	var logw io.Writer
+	if blog != nil {
+		logw = blog
+	}
+	res, retries, err, setupErr := s.buildWithRetries(ctx, func() (cmdOutput, error, error) {
+		events.add("sandbox-started")
+		defer events.add("compiler-exited")
+		return s.runBuild(ctx, jobDir, argv, plan.post, req.Network, logw)
+	})
+	s.closeBuildLog(id, blog)
+	out := string(res.combined())
+	logURL := ""
+	if blog != nil {
+		logURL = s.publicURL(r, "/v"+apiVersion+"/jobs/"+id+"/log")
+	}
+	compiled := time.Since(buildStart)
+	setServerTiming(w, queued, compiled)
+	// failCompile answers that the job failed with msg, along with its output and details
+	failCompile := func(status int, msg string) {
+		resp := CompileResponse{OK: false, ID: id, TraceID: traceID(r.Context()), Error: msg, Stdout: string(res.stdout), Stderr: string(res.stderr), Log: logURL, Retries: retries, Events: events.list(), ArgsUsed: args, ArgsRejected: rejected,
+			QueuedMs: queued.Milliseconds(), CompileMs: compiled.Milliseconds(), Diagnostics: countDiagnostics(out)}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+	if setupErr != nil {
+		writeInternalError(w, setupErr)
+		return
+	}
+	if retries > 0 {
+		log.Printf("job %s: retried %d time(s) after transient failures", id, retries)
+	}
+	if err != nil {
+		// Return compile error details
+		failCompile(http.StatusBadRequest, out)
+		return
+	}
+
+	// Move everything the build produced to artifacts/<id>
+	outputs, err := discoverOutputs(jobDir, sourceName(lang), plan, s.skeletonEntries())
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	// before validation reads the outputs into memory and hooks run on them
+	if err := s.checkOutputSizes(jobDir, outputs); err != nil {
+		failCompile(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.validateOutputs(ctx, jobDir, outputs); err != nil {
+		// A clean compile with broken outputs is a toolchain fault, not the user's
+		failCompile(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(s.cfg.PostHooks) > 0 {
+		err := s.runCommandHooks(context.Background(), id, jobDir, outputs, nil)
+		if err == nil {
+			// hooks may add files, such as signatures, that are published too
+			outputs, err = discoverOutputs(jobDir, sourceName(lang), plan, s.skeletonEntries())
+		}
+		if err != nil {
+			failCompile(http.StatusInternalServerError, err.Error())
+			return
+		}
+		// again, for the files hooks added
+		if err := s.checkOutputSizes(jobDir, outputs); err != nil {
+			failCompile(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).UTC()
+	}
+	manifest := ArtifactManifest{ID: id, Created: time.Now().UTC(), Output: mode, Args: args, TTLHours: req.TTLHours, Expires: expires}
+	if outputs, err = s.writeManifest(jobDir, manifest, outputs); err != nil {
+		writeInternalError(w, fmt.Errorf("writing %s: %w", manifestName, err))
+		return
+	}
+	if outputs, err = s.signProvenance(id, jobDir, argv, outputs); err != nil {
+		writeInternalError(w, fmt.Errorf("signing provenance: %w", err))
+		return
+	}
+	if err := s.publishArtifacts(jobDir, artDir, outputs, plan.files); err != nil {
+		// Never answer ok with URLs that lead nowhere
+		log.Printf("job %s: publishing artifacts: %v", id, err)
+		failCompile(http.StatusInternalServerError, "publishing artifacts: "+err.Error())
+		return
+	}
+	baseURL := s.artifactsBaseURL(r)
+	ev := PostHookEvent{ID: id, Files: make(map[string]string)}
+	for _, name := range outputs {
+		ev.Files[name] = fmt.Sprintf("%s/%s/%s", baseURL, id, name)
+	}
+	if err := s.runURLHooks(r.Context(), ev); err != nil {
+		// the build is withdrawn, as its recipient never got it
+		_ = os.RemoveAll(artDir)
+		failCompile(http.StatusInternalServerError, err.Error())
+		return
+	}
+	events.add("artifacts-published")
+	if req.TTLHours != 0 {
+		if err := s.writeArtifactMeta(id, artifactMeta{Expires: expires}); err != nil {
+			writeInternalError(w, fmt.Errorf("recording expiry: %w", err))
+			return
+		}
+	}
+
+	// Respond with URLs
+	resp := CompileResponse{
+		OK:           true,
+		ID:           id,
+		TraceID:      traceID(r.Context()),
+		Output:       mode,
+		Files:        make(map[string]string),
+		Log:          logURL,
+		Retries:      retries,
+		ArgsUsed:     args,
+		ArgsRejected: rejected,
+		Expires:      expires,
+		Events:       events.list(),
+		QueuedMs:     queued.Milliseconds(),
+		CompileMs:    compiled.Milliseconds(),
+		Diagnostics:  countDiagnostics(out),
+		Profile:      profile,
+		Stdout:       string(res.stdout),
+		Stderr:       string(res.stderr),
+	}
+	for _, name := range outputs {
+		url := fmt.Sprintf("%s/%s/%s", baseURL, id, name)
+		resp.Files[name] = url
+		switch name {
+		case base + ".js":
+			resp.JS = url
+		case base + ".wasm":
+			resp.WASM = url
+		case base + ".wat":
+			resp.WAT = url
+		case base + ".debug.wasm":
+			resp.Debug = url
+		default:
+			if slices.Contains(plan.files, name) {
+				resp.Artifact = url
+			}
+		}
+	}
+	resp.Features = s.wasmFeatures(args)
+	if req.Alias != "" {
+		if err := s.setAlias(req.Alias, id); err != nil {
+			writeInternalError(w, fmt.Errorf("alias: %w", err))
+			return
+		}
+		resp.Alias = s.aliasURL(r, req.Alias)
+	}
+	if req.Preview {
+		pid, err := s.setPreview(req.PreviewID, id)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		resp.PreviewID = pid
+		resp.Preview = s.previewURL(r, pid)
+	}
+	if req.SizeReport && resp.WASM != "" {
+		resp.SizeReport = sizeReportFor(artDir, base)
+	}
+	if wasmBody {
+		serveWasmBody(w, r, artDir, resp, base)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// runBuild runs the compiler and then the post-processing steps in jobDir, copying
+// their output to logw if set; runErr is the failure of the build itself, err a
+// command that could not be set up
+func (s *Server) runBuild(ctx context.Context, jobDir string, argv []string, post [][]string, network bool, logw io.Writer) (out cmdOutput, runErr, err error) {
+	cmd, err := s.compileCommand(ctx, jobDir, argv, network)
+	if err != nil {
+		return out, nil, err
+	}
+	out, runErr = s.runLogged(cmd, logw)
+	s.checkSandboxLaunch(runErr)
+	// Post-processing steps such as archiving run only after a clean compile
+	for i := 0; runErr == nil && i < len(post); i++ {
+		step, err := s.compileCommand(ctx, jobDir, post[i], false)
+		if err != nil {
+			return out, nil, err
+		}
+		var more cmdOutput
+		more, runErr = s.runLogged(step, logw)
+		out.add(more)
+	}
+	return out, runErr, nil
+}
+
+// processWaitDelay bounds how long Wait waits for a killed compile's output to close
+const processWaitDelay = 2 * time.Second
+
+// SandboxExecArg makes the daemon binary act as the Landlock sandbox-exec helper
+const SandboxExecArg = "-sandbox-exec"
+
+// compileTimeout bounds one compile or analysis, post-processing steps included
+func (s *Server) compileTimeout() time.Duration {
+	return time.Duration(s.cfg.CompileTimeoutSecs) * time.Second
+}
+
+// longestJob returns the longest a job can run: the largest timeout heavy args
+// grant, with time to download ports and every post hook's timeout on top
+func (s *Server) longestJob() time.Duration {
+	longest := s.compileTimeout()
+	for _, h := range s.cfg.HeavyArgs {
+		longest = max(longest, time.Duration(h.TimeoutSecs)*time.Second)
+	}
+	longest += time.Duration(s.cfg.PortFetchTimeoutSecs) * time.Second
+	for _, h := range s.cfg.PostHooks {
+		longest += h.hookTimeout()
+	}
+	return longest
+}
+
+// timeLimitSecs returns the whole seconds left until ctx's deadline, which the
+// sandbox enforces as well, or compileTimeoutSecs without one
+func (s *Server) timeLimitSecs(ctx context.Context) int {
+	if d, ok := ctx.Deadline(); ok {
+		return max(1, int(time.Until(d).Seconds()+0.5))
+	}
+	return s.cfg.CompileTimeoutSecs
+}
+
+// cpuLimitSecs returns the CPU time rlimit of a sandboxed process with ctx's
+// deadline; threads add up, so a process may use every CPU for the whole time limit
+func (s *Server) cpuLimitSecs(ctx context.Context) int {
+	return s.timeLimitSecs(ctx) * runtime.NumCPU()
+}
+
+// compileCommand builds the process running argv in jobDir, inside nsjail when enabled;
+// network grants access through the egress proxy
+func (s *Server) compileCommand(ctx context.Context, jobDir string, argv []string, network bool) (*exec.Cmd, error) {
 	var cmd *exec.Cmd
 	if s.cfg.NsJailEnabled {
 		// Run within nsjail if enabled. We bind mount jobDir to /work and compile there.
-		nsArgs := []string{
-			"--quiet",
-			"--iface_no_lo",
-			"--cwd", "/work",
-			"--bindmount", fmt.Sprintf("%s:/work", jobDir),
-			"--rlimit_fsize", fmt.Sprintf("%d", 256*1024*1024), // 256MiB
-			"--",
-			compiler,
-			srcName,
-		}
-		nsArgs = append(nsArgs, args...)
-		cmd = exec.CommandContext(ctx, s.cfg.NsJailPath, nsArgs...)
+		var err error
+		cmd, err = s.nsjailCommand(ctx, jobDir, argv, network)
+		if err != nil {
+			return nil, err
+		}
+	} else if s.cfg.LandlockEnabled {
+		var err error
+		cmd, err = s.landlockCommand(ctx, jobDir, argv)
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		// Direct execution fallback (for local dev / MVP)
-		fullArgs := append([]string{srcName}, args...)
-		cmd = exec.CommandContext(ctx, compiler, fullArgs...)
+		cmd = exec.CommandContext(ctx, compilerBinary(argv[0]), argv[1:]...)
 		cmd.Dir = jobDir
 	}
+	configureProcess(cmd)
+	// Output pipes held open by a stray grandchild must not block Wait after a kill
+	cmd.WaitDelay = processWaitDelay
+	if s.cfg.CompileUID >= 0 && !s.cfg.NsJailEnabled {
+		// nsjail switches users itself
+		setCredential(cmd, s.cfg.CompileUID, s.cfg.CompileGID)
+	}
 
 	// Inherit minimal environment for emscripten if needed
-	cmd.Env = os.Environ()
+	cmd.Env = append(os.Environ(), cmd.Env...)
+	// nsjail sets EM_CACHE itself; elsewhere emcc finds the shared cache on its own
+	if cache := s.jobCacheDir(jobDir); !s.cfg.NsJailEnabled && cache != s.emCacheDir() {
+		cmd.Env = append(cmd.Env, "EM_CACHE="+cache)
+	}
+	if !s.cfg.NsJailEnabled {
+		abs, err := filepath.Abs(jobDir)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, s.ccacheEnv(abs)...)
+	}
+	return cmd, nil
+}
 
-	out, err := cmd.CombinedOutput()
+// sizeReportFor analyzes the published module in artDir; failures only drop the report
+func sizeReportFor(artDir, base string) *SizeReport {
+	b, err := os.ReadFile(filepath.Join(artDir, base+".wasm"))
 	if err != nil {
-		// Return compile error details
-		resp := CompileResponse{OK: false, ID: id, Error: string(out)}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
-		return
+		log.Printf("size report: %v", err)
+		return nil
 	}
-
-	// Move artifacts to artifacts/<id>
-	// Emscripten will place .wasm next to .js
-	wasmSrc := filepath.Join(jobDir, "app.wasm")
-	jsSrc := filepath.Join(jobDir, "app.js")
-	jsDst := filepath.Join(artDir, "app.js")
-	wasmDst := filepath.Join(artDir, "app.wasm")
-	// Best-effort copy/move
-	_ = os.Rename(jsSrc, jsDst)
-	_ = os.Rename(wasmSrc, wasmDst)
-
-	// Cleanup job dir (best-effort)
-	_ = os.RemoveAll(jobDir)
-
-	// Respond with URLs
-	baseURL := "/" + strings.TrimPrefix(s.cfg.ArtifactsDir, "/")
-	resp := CompileResponse{
-		OK:   true,
-		ID:   id,
-		JS:   fmt.Sprintf("%s/%s/app.js", baseURL, id),
-		WASM: fmt.Sprintf("%s/%s/app.wasm", baseURL, id),
+	report, err := buildSizeReport(b)
+	if err != nil {
+		log.Printf("size report: %v", err)
+		return nil
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(resp)
-}
\ No newline at end of file
+	if fi, err := os.Stat(filepath.Join(artDir, base+".js")); err == nil {
+		report.JSBytes = fi.Size()
+	}
+	return report
+}
@@ -0,0 +1,157 @@
+package src
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// withCompression gzip- or deflate-encodes responses whose content type is in
+// compressContentTypes once they reach compressMinBytes, as the client accepts
+func (s *Server) withCompression(next http.Handler) http.Handler {
+	if !s.cfg.CompressResponses {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if enc == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, s: s, enc: enc, status: http.StatusOK}
+		defer cw.finish()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding picks gzip or deflate from an Accept-Encoding header, preferring gzip
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressWriter holds back the start of a response until it knows whether the
+// response is worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	s       *Server
+	enc     string
+	status  int
+	buf     []byte
+	decided bool
+	zw      io.WriteCloser // nil when the response goes out as is
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if !cw.decided {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.s.cfg.CompressMinBytes {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.zw != nil {
+		return cw.zw.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been written so far, so streamed responses keep streaming
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(true)
+	}
+	if f, ok := cw.zw.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide writes the header, compressing the body if allowed and the content type
+// is eligible, then writes out what was held back
+func (cw *compressWriter) decide(allowed bool) error {
+	cw.decided = true
+	h := cw.Header()
+	eligible := cw.s.compressible(h.Get("Content-Type"))
+	if eligible {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	// partial and already encoded content must pass through untouched
+	if allowed && eligible && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified && cw.status != http.StatusPartialContent {
+		h.Set("Content-Encoding", cw.enc)
+		h.Del("Content-Length")
+		if cw.enc == "gzip" {
+			cw.zw = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			// HTTP's deflate is the zlib format, not a raw deflate stream
+			cw.zw = zlib.NewWriter(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.zw != nil {
+		_, err = cw.zw.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// finish completes the response; bodies that stayed under the threshold go out uncompressed
+func (cw *compressWriter) finish() {
+	if !cw.decided {
+		_ = cw.decide(false)
+	}
+	if cw.zw != nil {
+		_ = cw.zw.Close()
+	}
+}
+
+// compressible reports whether responses of content type ct may be compressed
+func (s *Server) compressible(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(s.cfg.CompressContentTypes, mt)
+}
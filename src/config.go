@@ -2,52 +2,638 @@ package src
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"net/http"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
+// outputNamePattern restricts outputName to a safe file base name
+var outputNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// headerNamePattern matches HTTP header names, which are RFC 9110 tokens
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// ConfigFileNames are the config files looked up in the working directory, in order of precedence
+var ConfigFileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// FindConfigFile returns the first existing config file, or config.json if none exists
+func FindConfigFile() string {
+	for _, name := range ConfigFileNames {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ConfigFileNames[0]
+}
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() Config {
 	return Config{
-		WorkingDir:            "/srv/emcc-sandboxd", // Default to standard service directory
-		Addr:                  ":8080",
-		BaseDir:               ".",
-		JobsDir:               "jobs",
-		ArtifactsDir:          "artifacts",
-		EnableStaticArtifacts: true,
-		ArtifactTTLDays:       3,
-		CleanupIntervalMins:   30,
+		WorkingDir:                "/srv/emcc-sandboxd", // Default to standard service directory
+		Addr:                      ":8080",
+		BaseDir:                   ".",
+		JobsDir:                   "jobs",
+		JobsTmpfsMB:               0,
+		ArtifactsDir:              "artifacts",
+		LogsDir:                   "logs",
+		BuildLogMaxKB:             1024,
+		BuildLogTTLHours:          72,
+		SharesDir:                 "shares",
+		ArtifactMetaDir:           "artifact-meta",
+		ShareTTLDays:              0,
+		OutputName:                "app",
+		EnableStaticArtifacts:     true,
+		ArtifactsAddr:             "",
+		ArtifactsBaseURL:          "",
+		TLSCertFile:               "",
+		TLSKeyFile:                "",
+		HTTP2:                     true,
+		H2C:                       false,
+		BasePath:                  "",
+		AbsoluteURLs:              false,
+		TrustedProxies:            []string{},
+		AllowHTMLOutput:           false,
+		AllowPreview:              false,
+		HTMLContentSecurityPolicy: defaultHTMLContentSecurityPolicy,
+		HTMLDisposition:           "auto",
+		ArtifactTTLDays:           3,
+		ArtifactTTLMinHours:       1,
+		ArtifactTTLMaxHours:       720,
+		CleanupIntervalMins:       30,
+		ExamplesDir:               "",
+		CompilerC:                 "emcc",
+		CompilerCpp:               "em++",
+		CcacheDir:                 "",
+		CcacheMaxSize:             "5G",
+		PCHDir:                    "",
+		PCHHeaders:                []string{"iostream", "string", "vector", "map", "algorithm", "memory"},
+		CcachePath:                "ccache",
 		DefaultArgs: []string{
 			"-sINVOKE_RUN=0",
 			"-sENVIRONMENT=web",
 			"-sALLOW_MEMORY_GROWTH=1",
 			"-sMODULARIZE=1",
 		},
-		NsJailEnabled:        false,
-		NsJailPath:           "nsjail",
-		CgroupV2Root:         "cgroup",
-		EnableResourceGating: false,
-		JobMemoryEstimateMB:  256,
+		NsJailEnabled:         false,
+		NsJailPath:            "nsjail",
+		NsJailReadOnlyMounts:  []string{"/usr", "/lib", "/lib64", "/bin", "/etc/alternatives"},
+		EmCacheMode:           emCacheShared,
+		EmsdkPath:             "",
+		NodePath:              "",
+		PythonPath:            "",
+		NsJailSeccompPolicy:   "default",
+		NetworkPolicy:         "none",
+		NetworkAllowlist:      []string{"github.com", "codeload.github.com", "objects.githubusercontent.com"},
+		NetworkProxyAddr:      "127.0.0.1:8079",
+		PortFetchTimeoutSecs:  300,
+		CompileUID:            -1,
+		CompileGID:            -1,
+		JobDirMode:            "0755",
+		ArtifactDirMode:       "0755",
+		ArtifactFileMode:      "0644",
+		ArtifactUID:           -1,
+		ArtifactGID:           -1,
+		AllowUnsafe:           false,
+		LandlockEnabled:       false,
+		CompilerOutputMaxKB:   256,
+		MatrixMaxVariants:     0,
+		CompileTimeoutSecs:    300,
+		MaxRequestKB:          1024,
+		MaxOutputMB:           100,
+		MaxOutputsTotalMB:     200,
+		CompileNice:           0,
+		CompileIOClass:        "",
+		CompileRetries:        0,
+		CompileRetryBackoffMs: 500,
+		ScanIncludes:          true,
+		OverlayJobDirs:        false,
+		JobSkeletonDir:        "",
+		JobScratchMB:          512,
+		CgroupV2Root:          "cgroup",
+		EnableResourceGating:  false,
+		JobMemoryEstimateMB:   256,
+		MemPressureMaxAvg10:   0,
+		AllowDynamicLinking:   false,
+		AllowNodeEnvironment:  false,
+		ClangTidyPath:         "clang-tidy",
+		ClangTidyChecks:       "clang-analyzer-*,bugprone-*",
+		EmscriptenSysroot:     "",
+		WasmDisassemblerPath:  "wasm2wat",
+		WasmValidatorPath:     "wasm-validate",
+		TargetProfiles:        defaultTargetProfiles(),
+		HeavyArgs:             defaultHeavyArgs(),
+		AllowedFeatureFlags: []string{
+			"-msimd128",
+			"-mrelaxed-simd",
+			"-mbulk-memory",
+			"-matomics",
+			"-mnontrapping-fptoint",
+			"-msign-ext",
+			"-mmutable-globals",
+			"-mmultivalue",
+			"-mreference-types",
+			"-mtail-call",
+		},
+		IdempotencyTTLHours:  0,
+		IdempotencyMaxKeys:   1000,
+		IdempotencyMaxMB:     16,
+		LoadShedEnabled:      false,
+		ShedMaxQueueDepth:    32,
+		ShedMaxFailureRate:   0.5,
+		ShedMaxMemoryPercent: 90,
+		ShedAnonymousShare:   0.75,
+		ShedWindowSecs:       60,
+		ShedRetryAfterSecs:   5,
+		CompressResponses:    true,
+		CompressMinBytes:     1024,
+		CompressContentTypes: []string{"application/json", "text/plain"},
+		AdminToken:           "",
+		OIDCRolesClaim:       "roles",
+		OIDCAdminRole:        "admin",
+		RequireAPIKey:        false,
+		APIKeysFile:          "api-keys.json",
+		DrainDelaySecs:       10,
+		SelftestIntervalMins: 0,
+		AlertWebhookURL:      "",
+		AlertSlackWebhookURL: "",
+		AlertMinIntervalMins: 15,
+		AlertMaxFailureRate:  0.5,
+		AlertDiskMinFreeMB:   1024,
 	}
 }
 
-// LoadConfig loads configuration from a file, falling back to defaults
+// LoadConfig loads configuration from a file, falling back to defaults.
+// Keys that do not match any config option are rejected.
 func LoadConfig(path string) (Config, error) {
+	cfg, unknown, err := readConfigFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if len(unknown) > 0 {
+		return cfg, fmt.Errorf("unknown config keys: %s", strings.Join(unknown, ", "))
+	}
+	return cfg, nil
+}
+
+// CheckConfig loads a config file and reports every problem found instead of stopping at the first.
+// Like the server, it changes to workingDir first, so relative paths are checked where they are used.
+func CheckConfig(path string) (Config, []string) {
+	cfg, unknown, err := readConfigFile(path)
+	if err != nil {
+		return cfg, []string{err.Error()}
+	}
+	var problems []string
+	for _, k := range unknown {
+		problems = append(problems, fmt.Sprintf("unknown key %q", k))
+	}
+	if cfg.WorkingDir != "" {
+		if err := os.Chdir(cfg.WorkingDir); err != nil {
+			return cfg, append(problems, fmt.Sprintf("failed to change working directory to '%s': %v", cfg.WorkingDir, err))
+		}
+	}
+	return cfg, append(problems, ValidateConfig(cfg)...)
+}
+
+// redactedValue stands in for secrets in printed configurations
+const redactedValue = "<set>"
+
+// Redacted returns cfg with its secrets, the admin token, OIDC settings and the
+// webhook, scanner and post hook URLs, which may carry credentials, replaced by
+// "<set>" where set
+func (cfg Config) Redacted() Config {
+	for _, f := range []*string{
+		&cfg.AdminToken, &cfg.OIDCIssuer, &cfg.OIDCAudience,
+		&cfg.AlertWebhookURL, &cfg.AlertSlackWebhookURL, &cfg.SourceScanURL,
+	} {
+		if *f != "" {
+			*f = redactedValue
+		}
+	}
+	cfg.PostHooks = slices.Clone(cfg.PostHooks)
+	for i := range cfg.PostHooks {
+		if cfg.PostHooks[i].URL != "" {
+			cfg.PostHooks[i].URL = redactedValue
+		}
+	}
+	return cfg
+}
+
+// readConfigFile decodes path over the defaults, returning unknown keys separately
+func readConfigFile(path string) (Config, []string, error) {
 	cfg := DefaultConfig()
-	f, err := os.Open(path)
+	b, err := os.ReadFile(path)
 	if err != nil {
-		// No config file is fine; return defaults
-		return cfg, nil
+		if errors.Is(err, os.ErrNotExist) {
+			// No config file is fine; return defaults
+			return cfg, nil, nil
+		}
+		return cfg, nil, err
 	}
-	defer f.Close()
-	dec := json.NewDecoder(f)
-	if err := dec.Decode(&cfg); err != nil {
-		return cfg, err
+	b, err = configToJSON(path, b)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("%s: %w", path, err)
 	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	unknown := unknownKeys(b, reflect.TypeOf(cfg), "")
+	sort.Strings(unknown)
+	// a null heavy arg withdraws a default
+	maps.DeleteFunc(cfg.HeavyArgs, func(_ string, h *HeavyArg) bool { return h == nil })
 	// derive durations
 	cfg.ArtifactTTL = time.Duration(cfg.ArtifactTTLDays) * 24 * time.Hour
-	return cfg, nil
+	return cfg, unknown, nil
+}
+
+// configToJSON converts YAML and TOML config files to JSON, selected by extension,
+// so every format shares the json field names and unknown key detection
+func configToJSON(path string, b []byte) ([]byte, error) {
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return b, nil
+	}
+	if doc == nil {
+		// empty document
+		return []byte("{}"), nil
+	}
+	return json.Marshal(doc)
+}
+
+// unknownKeys lists object keys in raw that encoding/json would silently ignore when decoding into t
+func unknownKeys(raw []byte, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(raw, &obj) != nil {
+			return nil
+		}
+		// encoding/json matches keys case-insensitively
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			fields[strings.ToLower(name)] = f.Type
+		}
+		for k, v := range obj {
+			ft, ok := fields[strings.ToLower(k)]
+			if !ok {
+				unknown = append(unknown, prefix+k)
+				continue
+			}
+			unknown = append(unknown, unknownKeys(v, ft, prefix+k+".")...)
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(raw, &items) != nil {
+			return nil
+		}
+		for i, item := range items {
+			unknown = append(unknown, unknownKeys(item, t.Elem(), fmt.Sprintf("%s%d.", prefix, i))...)
+		}
+	}
+	return unknown
+}
+
+// ValidateConfig reports invalid values and combinations of options
+func ValidateConfig(cfg Config) []string {
+	var problems []string
+	if err := ValidatePlatform(cfg); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if cfg.BaseDir == "" {
+		problems = append(problems, "baseDir empty")
+	}
+	if cfg.Addr == "" {
+		problems = append(problems, "addr empty")
+	}
+	if b := cfg.BasePath; b != "" && (!strings.HasPrefix(b, "/") || path.Clean(b) != b || b == "/") {
+		problems = append(problems, "basePath must start with / and not end with one, e.g. /emcc")
+	}
+	if _, err := parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		problems = append(problems, "trustedProxies: "+err.Error())
+	}
+	if cfg.ArtifactsAddr != "" && cfg.ArtifactsAddr == cfg.Addr {
+		problems = append(problems, "artifactsAddr must differ from addr")
+	}
+	switch cfg.HTMLDisposition {
+	case "auto", "inline", "attachment":
+	default:
+		problems = append(problems, "htmlDisposition must be 'auto', 'inline' or 'attachment'")
+	}
+	for name, value := range cfg.ArtifactHeaders {
+		switch {
+		case !headerNamePattern.MatchString(name):
+			problems = append(problems, fmt.Sprintf("artifactHeaders: invalid header name %q", name))
+		case strings.ContainsFunc(value, unicode.IsControl):
+			problems = append(problems, fmt.Sprintf("artifactHeaders[%q]: value contains control characters", name))
+		}
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Type", "Content-Length", "Content-Encoding", "Transfer-Encoding", "Content-Range":
+			problems = append(problems, fmt.Sprintf("artifactHeaders[%q]: set by the file server for each response", name))
+		}
+	}
+	if cfg.JobsDir == cfg.ArtifactsDir {
+		problems = append(problems, "jobsDir and artifactsDir must differ")
+	}
+	if cfg.ArtifactMetaDir == cfg.JobsDir || cfg.ArtifactMetaDir == cfg.ArtifactsDir || cfg.ArtifactMetaDir == cfg.LogsDir || cfg.ArtifactMetaDir == cfg.SharesDir {
+		problems = append(problems, "artifactMetaDir must differ from jobsDir, artifactsDir, logsDir and sharesDir")
+	}
+	if cfg.ArtifactTTLMinHours < 1 || cfg.ArtifactTTLMaxHours < cfg.ArtifactTTLMinHours {
+		problems = append(problems, "artifactTTLMinHours must be positive and at most artifactTTLMaxHours")
+	}
+	if cfg.BuildLogMaxKB > 0 && (cfg.LogsDir == cfg.JobsDir || cfg.LogsDir == cfg.ArtifactsDir) {
+		problems = append(problems, "logsDir must differ from jobsDir and artifactsDir")
+	}
+	if cfg.ShareTTLDays > 0 && (cfg.SharesDir == cfg.JobsDir || cfg.SharesDir == cfg.ArtifactsDir || cfg.SharesDir == cfg.LogsDir) {
+		problems = append(problems, "sharesDir must differ from jobsDir, artifactsDir and logsDir")
+	}
+	if cfg.ShareTTLDays < 0 {
+		problems = append(problems, "shareTTLDays must not be negative")
+	}
+	for name, p := range cfg.TargetProfiles {
+		if !profileNamePattern.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("targetProfiles: invalid profile name %q", name))
+		}
+		if slices.Contains(p.Args, "") {
+			problems = append(problems, fmt.Sprintf("targetProfiles: profile %s has an empty arg", name))
+		}
+	}
+	for flag, h := range cfg.HeavyArgs {
+		if !strings.HasPrefix(flag, "-") {
+			problems = append(problems, fmt.Sprintf("heavyArgs: %q is not a flag", flag))
+		}
+		if h.TimeoutSecs < 0 {
+			problems = append(problems, fmt.Sprintf("heavyArgs: %s: timeoutSecs must not be negative", flag))
+		}
+		if h.MemoryMultiplier != 0 && h.MemoryMultiplier < 1 {
+			problems = append(problems, fmt.Sprintf("heavyArgs: %s: memoryMultiplier must be at least 1", flag))
+		}
+	}
+	for i, h := range cfg.PostHooks {
+		if h.Name == "" {
+			problems = append(problems, fmt.Sprintf("postHooks[%d]: name is required", i))
+		}
+		if (len(h.Command) == 0) == (h.URL == "") {
+			problems = append(problems, fmt.Sprintf("postHooks[%d]: set exactly one of command and url", i))
+		}
+		if h.OnFailure != "" && h.OnFailure != hookFail && h.OnFailure != hookIgnore {
+			problems = append(problems, fmt.Sprintf("postHooks[%d]: onFailure must be %q or %q", i, hookFail, hookIgnore))
+		}
+		if h.TimeoutSecs < 0 {
+			problems = append(problems, fmt.Sprintf("postHooks[%d]: timeoutSecs must not be negative", i))
+		}
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		problems = append(problems, "tlsCertFile and tlsKeyFile must be set together")
+	}
+	if cfg.H2C && len(cfg.TrustedProxies) == 0 {
+		problems = append(problems, "h2c requires trustedProxies")
+	}
+	if cfg.AllowPreview && (!cfg.AllowHTMLOutput || !cfg.EnableStaticArtifacts) {
+		problems = append(problems, "allowPreview requires allowHTMLOutput and enableStaticArtifacts")
+	}
+	if cfg.MatrixMaxVariants < 0 {
+		problems = append(problems, "matrixMaxVariants must not be negative")
+	}
+	if cfg.CompilerOutputMaxKB <= 0 {
+		problems = append(problems, "compilerOutputMaxKB must be positive")
+	}
+	if cfg.BuildLogMaxKB < 0 || cfg.BuildLogTTLHours < 0 {
+		problems = append(problems, "buildLogMaxKB and buildLogTTLHours must not be negative")
+	}
+	if !outputNamePattern.MatchString(cfg.OutputName) {
+		problems = append(problems, "outputName must be a plain file name of letters, digits, '_' or '-'")
+	}
+	if cfg.ExamplesDir != "" {
+		if fi, err := os.Stat(cfg.ExamplesDir); err != nil || !fi.IsDir() {
+			problems = append(problems, "examplesDir must be an existing directory")
+		}
+	}
+	if len(strings.Fields(cfg.CompilerC)) == 0 || len(strings.Fields(cfg.CompilerCpp)) == 0 {
+		problems = append(problems, "compilerC and compilerCpp must not be empty")
+	}
+	if cfg.NsJailEnabled && cfg.NsJailPath == "" {
+		problems = append(problems, "nsjailEnabled requires nsjailPath")
+	}
+	// nsjail mounts these at the same path inside the jail
+	for _, p := range append([]string{cfg.EmsdkPath, cfg.NodePath, cfg.PythonPath, cfg.CcacheDir, cfg.PCHDir}, cfg.NsJailReadOnlyMounts...) {
+		if p != "" && !filepath.IsAbs(p) {
+			problems = append(problems, fmt.Sprintf("%q must be an absolute path", p))
+		}
+	}
+	if cfg.CcacheDir != "" {
+		if _, err := exec.LookPath(cfg.CcachePath); err != nil {
+			problems = append(problems, fmt.Sprintf("ccacheDir requires ccache: %v", err))
+		}
+	}
+	if p := cfg.NsJailSeccompPolicy; p != "" && p != "default" {
+		if _, err := os.Stat(p); err != nil {
+			problems = append(problems, fmt.Sprintf("nsjailSeccompPolicy: %v", err))
+		}
+	}
+	for _, h := range cfg.PCHHeaders {
+		if !pchHeaderPattern.MatchString(h) {
+			problems = append(problems, fmt.Sprintf("pchHeaders: invalid header %q", h))
+		}
+	}
+	for key, mode := range map[string]string{"jobDirMode": cfg.JobDirMode, "artifactDirMode": cfg.ArtifactDirMode, "artifactFileMode": cfg.ArtifactFileMode} {
+		if _, err := parseMode(mode); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	if cfg.EmCacheMode != emCacheShared && cfg.EmCacheMode != emCachePrivate {
+		problems = append(problems, "emCacheMode must be 'shared' or 'private'")
+	}
+	switch cfg.NetworkPolicy {
+	case networkNone:
+	case networkAllowlist:
+		if cfg.NetworkProxyAddr == "" {
+			problems = append(problems, "networkPolicy allowlist requires networkProxyAddr")
+		}
+		// only a network namespace of its own keeps a job from bypassing the proxy
+		if !cfg.NsJailEnabled {
+			problems = append(problems, "networkPolicy allowlist requires nsjailEnabled")
+		}
+	default:
+		problems = append(problems, "networkPolicy must be 'none' or 'allowlist'")
+	}
+	if cfg.IdempotencyTTLHours > 0 && (cfg.IdempotencyMaxKeys <= 0 || cfg.IdempotencyMaxMB <= 0) {
+		problems = append(problems, "idempotencyTTLHours requires positive idempotencyMaxKeys and idempotencyMaxMB")
+	}
+	if cfg.PortFetchTimeoutSecs < 0 {
+		problems = append(problems, "portFetchTimeoutSecs must not be negative")
+	}
+	problems = append(problems, validatePrivileges(cfg)...)
+	if cfg.LandlockEnabled && !cfg.NsJailEnabled {
+		if _, err := landlockABI(); err != nil {
+			problems = append(problems, "landlockEnabled: "+err.Error())
+		}
+	}
+	if cfg.CompressMinBytes < 0 {
+		problems = append(problems, "compressMinBytes must not be negative")
+	}
+	if cfg.RequireAPIKey && cfg.AdminToken == "" && cfg.OIDCIssuer == "" {
+		problems = append(problems, "requireAPIKey requires adminToken or oidcIssuer, through which the keys are managed")
+	}
+	for path, name := range cfg.EndpointRoles {
+		if _, ok := roleNames[name]; !ok {
+			problems = append(problems, fmt.Sprintf("endpointRoles[%q]: unknown role %q, want anonymous, user or admin", path, name))
+		}
+		if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "/admin/") {
+			problems = append(problems, fmt.Sprintf("endpointRoles[%q]: want an API path such as /compile; /admin/ paths always require admin", path))
+		}
+	}
+	if len(cfg.SourceScanCommand) > 0 && cfg.SourceScanCommand[0] == "" {
+		problems = append(problems, "sourceScanCommand must start with the scanner binary")
+	}
+	if cfg.MaxOutputMB < 0 || cfg.MaxOutputsTotalMB < 0 {
+		problems = append(problems, "maxOutputMB and maxOutputsTotalMB must not be negative")
+	}
+	if cfg.MaxRequestKB < 0 {
+		problems = append(problems, "maxRequestKB must not be negative")
+	}
+	if cfg.AnonymousCompileTimeoutSecs < 0 {
+		problems = append(problems, "anonymousCompileTimeoutSecs must not be negative")
+	}
+	if cfg.OIDCIssuer != "" && !strings.HasPrefix(cfg.OIDCIssuer, "https://") && !strings.HasPrefix(cfg.OIDCIssuer, "http://") {
+		problems = append(problems, "oidcIssuer must be an http(s) URL")
+	}
+	if cfg.SelftestIntervalMins < 0 {
+		problems = append(problems, "selftestIntervalMins must not be negative")
+	}
+	if cfg.DrainDelaySecs < 0 {
+		problems = append(problems, "drainDelaySecs must not be negative")
+	}
+	if cfg.CompileTimeoutSecs <= 0 {
+		problems = append(problems, "compileTimeoutSecs must be positive")
+	}
+	if cfg.CompileNice < 0 || cfg.CompileNice > 19 {
+		problems = append(problems, "compileNice must be between 0 and 19")
+	}
+	if cfg.CompileIOClass != "" && cfg.CompileIOClass != "best-effort" && cfg.CompileIOClass != "idle" {
+		problems = append(problems, "compileIOClass must be empty, 'best-effort' or 'idle'")
+	}
+	if cfg.CompileRetries < 0 || cfg.CompileRetries > 5 {
+		problems = append(problems, "compileRetries must be between 0 and 5")
+	}
+	if cfg.CompileRetryBackoffMs < 0 {
+		problems = append(problems, "compileRetryBackoffMs must not be negative")
+	}
+	if cfg.JobsTmpfsMB < 0 {
+		problems = append(problems, "jobsTmpfsMB must not be negative")
+	}
+	if cfg.OverlayJobDirs {
+		if cfg.JobSkeletonDir == "" {
+			problems = append(problems, "overlayJobDirs requires jobSkeletonDir")
+		} else if strings.ContainsAny(cfg.JobSkeletonDir, ",:") {
+			// overlayfs mount options are separated by ',' and ':'
+			problems = append(problems, "jobSkeletonDir must not contain ',' or ':'")
+		} else if fi, err := os.Stat(cfg.JobSkeletonDir); err != nil || !fi.IsDir() {
+			problems = append(problems, "jobSkeletonDir must be an existing directory")
+		}
+		if cfg.JobScratchMB <= 0 {
+			problems = append(problems, "jobScratchMB must be positive")
+		}
+	}
+	if cfg.EnableResourceGating && cfg.CgroupV2Root == "" {
+		problems = append(problems, "enableResourceGating requires cgroupV2Root")
+	}
+	if cfg.ArtifactTTLDays < 0 {
+		problems = append(problems, "artifactTTLDays must not be negative")
+	}
+	if cfg.JobMemoryEstimateMB < 0 {
+		problems = append(problems, "jobMemoryEstimateMB must not be negative")
+	}
+	if cfg.MemPressureMaxAvg10 < 0 || cfg.MemPressureMaxAvg10 > 100 {
+		problems = append(problems, "memPressureMaxAvg10 must be between 0 and 100")
+	}
+	if cfg.ShedMaxFailureRate < 0 || cfg.ShedMaxFailureRate > 1 {
+		problems = append(problems, "shedMaxFailureRate must be between 0 and 1")
+	}
+	if cfg.ShedAnonymousShare <= 0 || cfg.ShedAnonymousShare > 1 {
+		problems = append(problems, "shedAnonymousShare must be above 0 and at most 1")
+	}
+	if cfg.AlertMaxFailureRate < 0 || cfg.AlertMaxFailureRate > 1 {
+		problems = append(problems, "alertMaxFailureRate must be between 0 and 1")
+	}
+	return problems
+}
+
+// validatePrivileges checks the user compiles would run as against the daemon's own
+func validatePrivileges(cfg Config) []string {
+	if (cfg.CompileUID < 0) != (cfg.CompileGID < 0) {
+		return []string{"compileUID and compileGID must be set together"}
+	}
+	euid := os.Geteuid()
+	if euid < 0 { // not a Unix system
+		return nil
+	}
+	if cfg.CompileUID >= 0 && cfg.CompileUID != euid && euid != 0 {
+		return []string{fmt.Sprintf("compileUID %d requires running as root (running as uid %d)", cfg.CompileUID, euid)}
+	}
+	if cfg.ArtifactUID >= 0 && cfg.ArtifactUID != euid && euid != 0 {
+		return []string{fmt.Sprintf("artifactUID %d requires running as root (running as uid %d)", cfg.ArtifactUID, euid)}
+	}
+	runsAsRoot := cfg.CompileUID == 0 || (cfg.CompileUID < 0 && euid == 0)
+	if runsAsRoot && !cfg.AllowUnsafe {
+		if cfg.NsJailEnabled {
+			return []string{"compiles would run as root inside nsjail; set compileUID/compileGID (or allowUnsafe)"}
+		}
+		return []string{"refusing to run compiles as root without nsjail; set compileUID/compileGID (or allowUnsafe)"}
+	}
+	return nil
+}
+
+// parseMode parses octal permissions such as "0644" or "2770", including the
+// setuid, setgid and sticky bits
+func parseMode(s string) (os.FileMode, error) {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0o7777 {
+		return 0, fmt.Errorf("invalid octal mode %q", s)
+	}
+	mode := os.FileMode(v & 0o777)
+	for bit, m := range map[uint64]os.FileMode{0o4000: os.ModeSetuid, 0o2000: os.ModeSetgid, 0o1000: os.ModeSticky} {
+		if v&bit != 0 {
+			mode |= m
+		}
+	}
+	return mode, nil
 }
 
 // ValidateDirs validates the configuration directories
@@ -61,3 +647,29 @@ func ValidateDirs(cfg Config) error {
 	}
 	return nil
 }
+
+// ValidatePlatform rejects Linux-only features on other operating systems
+func ValidatePlatform(cfg Config) error {
+	if runtime.GOOS == "linux" {
+		return nil
+	}
+	if cfg.NsJailEnabled {
+		return fmt.Errorf("nsjailEnabled requires Linux (running on %s)", runtime.GOOS)
+	}
+	if cfg.EnableResourceGating {
+		return fmt.Errorf("enableResourceGating requires Linux cgroups v2 (running on %s)", runtime.GOOS)
+	}
+	if cfg.OverlayJobDirs {
+		return fmt.Errorf("overlayJobDirs requires Linux overlayfs (running on %s)", runtime.GOOS)
+	}
+	if cfg.CompileNice != 0 || cfg.CompileIOClass != "" {
+		return fmt.Errorf("compileNice and compileIOClass require Linux (running on %s)", runtime.GOOS)
+	}
+	if cfg.CompileUID >= 0 && runtime.GOOS == "windows" {
+		return fmt.Errorf("compileUID is not supported on %s", runtime.GOOS)
+	}
+	if (cfg.ArtifactUID >= 0 || cfg.ArtifactGID >= 0) && runtime.GOOS == "windows" {
+		return fmt.Errorf("artifactUID and artifactGID are not supported on %s", runtime.GOOS)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Network policies selectable via Config.NetworkPolicy
+const (
+	networkNone      = "none"
+	networkAllowlist = "allowlist"
+)
+
+// jailEgressSocket is where the egress proxy's socket appears inside the jail
+const jailEgressSocket = "/egress.sock"
+
+// egressSocketPath returns the Unix socket the egress proxy listens on. Jobs with
+// network access keep a network namespace of their own, with only loopback, and
+// reach the proxy through this socket bind mounted into the jail.
+func (s *Server) egressSocketPath() (string, error) {
+	return filepath.Abs(filepath.Join(s.cfg.BaseDir, "egress.sock"))
+}
+
+// startEgressProxy serves the CONNECT proxy that jobs granted network access go through
+func (s *Server) startEgressProxy() error {
+	if s.cfg.NetworkPolicy != networkAllowlist {
+		return nil
+	}
+	sock, err := s.egressSocketPath()
+	if err != nil {
+		return err
+	}
+	// a socket left behind by an earlier run would make Listen fail
+	_ = os.Remove(sock)
+	s.egressSrv = &http.Server{Handler: http.HandlerFunc(s.handleEgress)}
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return err
+	}
+	// jobs may run as compileUID, which must be able to connect
+	if err := os.Chmod(sock, 0o666); err != nil {
+		ln.Close()
+		return err
+	}
+	log.Printf("egress proxy on %s", sock)
+	go func() {
+		if err := s.egressSrv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("egress proxy: %v", err)
+		}
+	}()
+	return nil
+}
+
+// handleEgress tunnels a CONNECT request to an allowlisted host on port 443
+func (s *Server) handleEgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil || port != "443" || !s.egressAllowed(host) {
+		log.Printf("egress denied: %s", r.Host)
+		http.Error(w, "destination not allowed", http.StatusForbidden)
+		return
+	}
+	upstream, err := egressDialer.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	_, _ = client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	go func() {
+		// bytes the client sent after the CONNECT headers are already buffered
+		_, _ = io.Copy(upstream, buf)
+		upstream.Close()
+	}()
+	_, _ = io.Copy(client, upstream)
+	client.Close()
+}
+
+// egressDialer connects to allowlisted hosts, refusing addresses that are not on the
+// public internet, such as loopback, private networks and cloud metadata services,
+// in case an allowlisted name resolves to one
+var egressDialer = &net.Dialer{
+	Timeout: 10 * time.Second,
+	Control: func(network, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		ip := ap.Addr().Unmap()
+		if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+			return fmt.Errorf("egress to %s is not allowed", ip)
+		}
+		return nil
+	},
+}
+
+// egressAllowed matches host against networkAllowlist; entries starting with '.' match subdomains
+func (s *Server) egressAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range s.cfg.NetworkAllowlist {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyEnv points a job granted network access at the relay to the egress proxy,
+// which listens on networkProxyAddr inside the job's network namespace
+func (s *Server) proxyEnv() []string {
+	url := "http://" + s.cfg.NetworkProxyAddr
+	return []string{"https_proxy=" + url, "HTTPS_PROXY=" + url, "http_proxy=" + url, "HTTP_PROXY=" + url}
+}
+
+// NetRelayArg makes the daemon binary act as the network relay of a jailed job
+const NetRelayArg = "-net-relay"
+
+// NetRelay is the body of the network relay, run inside the jail as
+// "-net-relay <socket> <addr> -- argv...": it forwards connections to addr, on the
+// job's own loopback, to the egress proxy behind socket, while running argv. It
+// returns argv's exit code.
+func NetRelay(args []string) int {
+	if len(args) < 4 || args[2] != "--" {
+		fmt.Fprintln(os.Stderr, "net-relay: usage: -net-relay <socket> <addr> -- command...")
+		return 126
+	}
+	sock, addr, argv := args[0], args[1], args[3:]
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "net-relay: %v\n", err)
+		return 126
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go relayConn(c, sock)
+		}
+	}()
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "net-relay: %v\n", err)
+		return 127
+	}
+	return 0
+}
+
+// relayConn copies c to and from a new connection to the proxy socket
+func relayConn(c net.Conn, sock string) {
+	defer c.Close()
+	upstream, err := net.Dial("unix", sock)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	go func() {
+		_, _ = io.Copy(upstream, c)
+		_ = upstream.(*net.UnixConn).CloseWrite()
+	}()
+	_, _ = io.Copy(c, upstream)
+}
@@ -0,0 +1,133 @@
+package src
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Emscripten cache modes, set per deployment by emCacheMode and per request by CompileRequest.Cache
+const (
+	emCacheShared = "shared" // jobs share the SDK's cache
+	// a job gets a copy-on-write cache of its own, so concurrent jobs cannot corrupt it
+	emCachePrivate = "private"
+)
+
+// emCacheDir returns the shared Emscripten cache of the configured emsdk, if any
+func (s *Server) emCacheDir() string {
+	if s.cfg.EmsdkPath == "" {
+		return ""
+	}
+	cache := filepath.Join(s.cfg.EmsdkPath, "upstream", "emscripten", "cache")
+	if _, err := os.Stat(cache); err != nil {
+		return ""
+	}
+	return cache
+}
+
+// privateCacheDir returns where the private Emscripten cache of the job in jobDir lives
+func privateCacheDir(jobDir string) string {
+	return jobDir + ".emcache"
+}
+
+// jobCacheDir returns the absolute path of the Emscripten cache the job in jobDir
+// uses: its private cache when it has one, otherwise the shared cache, if any
+func (s *Server) jobCacheDir(jobDir string) string {
+	dir := privateCacheDir(jobDir)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return s.emCacheDir()
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// newPrivateCache gives the job in jobDir a private cache seeded from the shared one.
+// An overlay makes this cheap; without mount privileges the shared cache is copied.
+func (s *Server) newPrivateCache(jobDir string) error {
+	dir := privateCacheDir(jobDir)
+	shared := s.emCacheDir()
+	if shared == "" {
+		// emcc fills an empty cache itself, only slower
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			return err
+		}
+	} else if err := mountJobOverlay(dir, shared, s.cfg.JobScratchMB); err != nil {
+		if err := copyTree(shared, dir); err != nil {
+			_ = os.RemoveAll(dir)
+			return err
+		}
+	}
+	if s.cfg.CompileUID >= 0 {
+		return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, s.cfg.CompileUID, s.cfg.CompileGID)
+		})
+	}
+	return nil
+}
+
+// removePrivateCache unmounts and deletes the private cache of the job in jobDir, if it has one
+func removePrivateCache(jobDir string) {
+	dir := privateCacheDir(jobDir)
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	// fails harmlessly for copied caches
+	_ = unmountJobOverlay(dir)
+	_ = os.RemoveAll(dir)
+}
+
+// copyTree copies the directory tree src to dst, which must not exist yet; symlinks are recreated, not followed
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target)
+		}
+		// sockets, fifos and devices have no place in a cache
+		return nil
+	})
+}
+
+// copyFile copies the regular file src to dst, keeping its permission bits
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,73 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Codes of the JSON error envelope; clients match on these, never on messages
+const (
+	codeMethodNotAllowed    = "method_not_allowed"
+	codeInvalidJSON         = "invalid_json"
+	codeUnsupportedVersion  = "unsupported_version"
+	codeMissingField        = "missing_field"
+	codeInvalidField        = "invalid_field"
+	codeFeatureDisabled     = "feature_disabled"
+	codeUnauthorized        = "unauthorized"
+	codeForbidden           = "forbidden"
+	codeNotFound            = "not_found"
+	codeCanceled            = "canceled"
+	codeIdempotencyConflict = "idempotency_conflict"
+	codeOverloaded          = "overloaded"
+	codeDraining            = "draining"
+	codeScanUnavailable     = "scan_unavailable"
+	codePortNotInstalled    = "port_not_installed"
+	codeInternal            = "internal_error"
+)
+
+// fieldError is a validation failure of one request field
+type fieldError struct {
+	field string
+	msg   string
+}
+
+func (e *fieldError) Error() string { return e.msg }
+
+// fieldErrorf returns a validation error for field
+func fieldErrorf(field, format string, args ...any) error {
+	return &fieldError{field: field, msg: fmt.Sprintf(format, args...)}
+}
+
+// writeError writes an error response as {"error": {"code", "message", "field"}}
+func writeError(w http.ResponseWriter, status int, code, field, message string) {
+	writeAPIError(w, status, APIError{Code: code, Message: message, Field: field})
+}
+
+// writeAPIError is writeError for errors carrying more than a message
+func writeAPIError(w http.ResponseWriter, status int, e APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ErrorResponse{Error: e})
+}
+
+// writeFieldError reports the invalid request field err names, or field if it names none
+func writeFieldError(w http.ResponseWriter, err error, field string) {
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		field = fe.field
+	}
+	writeError(w, http.StatusBadRequest, codeInvalidField, field, err.Error())
+}
+
+// writeInternalError reports a failure of the service itself
+func writeInternalError(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusInternalServerError, codeInternal, "", err.Error())
+}
+
+// writeMethodNotAllowed rejects a request with the wrong method
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "", "method not allowed")
+}
@@ -0,0 +1,128 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// exampleNamePattern restricts example names to plain file base names
+var exampleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// exampleTypes maps the source file extensions of examples to request types
+var exampleTypes = map[string]string{".c": "c", ".cpp": "cpp", ".cc": "cpp", ".cxx": "cpp"}
+
+// loadExamples reads the example programs in examplesDir; the directory is read on
+// every request, so examples can be edited without a restart
+func (s *Server) loadExamples() ([]Example, error) {
+	entries, err := os.ReadDir(s.cfg.ExamplesDir)
+	if err != nil {
+		return nil, err
+	}
+	var examples []Example
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		name := strings.TrimSuffix(e.Name(), ext)
+		typ, ok := exampleTypes[ext]
+		if !ok || !e.Type().IsRegular() || !exampleNamePattern.MatchString(name) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.cfg.ExamplesDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		examples = append(examples, Example{Name: name, Type: typ, Description: exampleDescription(string(b)), Code: string(b)})
+	}
+	sort.Slice(examples, func(i, j int) bool { return examples[i].Name < examples[j].Name })
+	return examples, nil
+}
+
+// exampleDescription returns the text of a leading // comment line, if any
+func exampleDescription(code string) string {
+	first, _, _ := strings.Cut(code, "\n")
+	if d, ok := strings.CutPrefix(strings.TrimSpace(first), "//"); ok {
+		return strings.TrimSpace(d)
+	}
+	return ""
+}
+
+// findExample returns the example called name, writing a 404 if there is none
+func (s *Server) findExample(w http.ResponseWriter, name string) (Example, bool) {
+	examples, err := s.loadExamples()
+	if err != nil {
+		writeInternalError(w, err)
+		return Example{}, false
+	}
+	for _, ex := range examples {
+		if ex.Name == name {
+			return ex, true
+		}
+	}
+	writeError(w, http.StatusNotFound, codeNotFound, "", "no example "+name)
+	return Example{}, false
+}
+
+// handleExamples serves GET /examples, the list of examples without their code
+func (s *Server) handleExamples(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	examples, err := s.loadExamples()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	list := make([]Example, 0, len(examples))
+	for _, ex := range examples {
+		ex.Code = ""
+		list = append(list, ex)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// handleExample serves GET /examples/{name}, one example with its code
+func (s *Server) handleExample(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	ex, ok := s.findExample(w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ex)
+}
+
+// handleExampleCompile serves POST /examples/{name}/compile. The optional body is a
+// compile request without code and type, which come from the example.
+func (s *Server) handleExampleCompile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	ex, ok := s.findExample(w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+	var req CompileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, "", "invalid JSON")
+		return
+	}
+	req.Code = ex.Code
+	req.Type = ex.Type
+	body, _ := json.Marshal(req)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	s.withLoadShedding(s.HandleCompile)(w, r)
+}
@@ -0,0 +1,155 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// artifactMeta is what the server records about a published artifact beyond its
+// files, kept in artifactMetaDir as <id>.json
+type artifactMeta struct {
+	Expires time.Time `json:"expires"`
+	// Pinned artifacts are kept regardless of Expires
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// manifestName is the file every artifact directory describes its build in
+const manifestName = "meta.json"
+
+// writeManifest completes m with the toolchain and the hashes of outputs and writes
+// it into jobDir, returning the outputs to publish with it
+func (s *Server) writeManifest(jobDir string, m ArtifactManifest, outputs []string) ([]string, error) {
+	files, err := hashFiles(jobDir, outputs)
+	if err != nil {
+		return nil, err
+	}
+	m.Toolchain, m.Files = s.toolchainVersion(), files
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(jobDir, manifestName), b, 0o644); err != nil {
+		return nil, err
+	}
+	return append(outputs, manifestName), nil
+}
+
+// artifactMetaPath returns where the record of artifact id is stored
+func (s *Server) artifactMetaPath(id string) string {
+	return filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactMetaDir, id+".json")
+}
+
+// readArtifactMeta returns the record of artifact id, if it has one
+func (s *Server) readArtifactMeta(id string) (artifactMeta, bool) {
+	var m artifactMeta
+	b, err := os.ReadFile(s.artifactMetaPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return s.manifestMeta(id)
+	}
+	if err != nil || json.Unmarshal(b, &m) != nil {
+		return m, false
+	}
+	return m, true
+}
+
+// manifestMeta rebuilds the record of artifact id from its meta.json, for artifacts
+// whose record was lost with artifactMetaDir. Only requests with a ttlHours of their
+// own got a record; pins are not in the manifest and stay lost.
+func (s *Server) manifestMeta(id string) (artifactMeta, bool) {
+	var man ArtifactManifest
+	b, err := os.ReadFile(filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, id, manifestName))
+	if err != nil || json.Unmarshal(b, &man) != nil || man.TTLHours == 0 {
+		return artifactMeta{}, false
+	}
+	return artifactMeta{Expires: man.Expires}, true
+}
+
+// writeArtifactMeta stores the record of artifact id
+func (s *Server) writeArtifactMeta(id string, m artifactMeta) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.artifactMetaPath(id), b, 0o644)
+}
+
+// requestTTL returns how long the artifacts of a compile asking for ttlHours are
+// kept: ttlHours within artifactTTLMinHours and artifactTTLMaxHours, or
+// artifactTTLDays when it is 0
+func (s *Server) requestTTL(ttlHours int) (time.Duration, error) {
+	if ttlHours == 0 {
+		return s.cfg.ArtifactTTL, nil
+	}
+	if ttlHours < s.cfg.ArtifactTTLMinHours || ttlHours > s.cfg.ArtifactTTLMaxHours {
+		return 0, fieldErrorf("ttlHours", "ttlHours must be between %d and %d", s.cfg.ArtifactTTLMinHours, s.cfg.ArtifactTTLMaxHours)
+	}
+	return time.Duration(ttlHours) * time.Hour, nil
+}
+
+// artifactExpiry returns when artifact id, published at modTime, expires: as
+// recorded for it, or artifactTTLDays after publishing. The zero time means never.
+func (s *Server) artifactExpiry(id string, modTime time.Time) time.Time {
+	if m, ok := s.readArtifactMeta(id); ok {
+		if m.Pinned {
+			return time.Time{}
+		}
+		return m.Expires
+	}
+	if s.cfg.ArtifactTTL <= 0 {
+		return time.Time{}
+	}
+	return modTime.Add(s.cfg.ArtifactTTL)
+}
+
+// handleArtifactPin serves POST and DELETE /artifacts/{id}/pin, which exempt an
+// artifact from cleanup and release it again, and GET reporting whether it is pinned
+func (s *Server) handleArtifactPin(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	dir := filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, id)
+	fi, err := os.Stat(dir)
+	if !jobIDPattern.MatchString(id) || err != nil || !fi.IsDir() {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no artifact "+id)
+		return
+	}
+	m, ok := s.readArtifactMeta(id)
+	if !ok && s.cfg.ArtifactTTL > 0 {
+		// keep the default expiry for when the artifact is unpinned
+		m.Expires = fi.ModTime().Add(s.cfg.ArtifactTTL).UTC()
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		m.Pinned = r.Method == http.MethodPost
+		if err := s.writeArtifactMeta(id, m); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	default:
+		writeMethodNotAllowed(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ArtifactStatus{ID: id, Pinned: m.Pinned, Expires: m.Expires})
+}
+
+// pruneArtifactMeta removes the records of artifacts that no longer exist
+func (s *Server) pruneArtifactMeta() {
+	dir := filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactMetaDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || s.artifactExists(id) {
+			continue
+		}
+		_ = os.Remove(filepath.Join(dir, e.Name()))
+	}
+}
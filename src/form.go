@@ -0,0 +1,156 @@
+package src
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxFormMemory bounds the part of a multipart compile request held in memory
+const maxFormMemory = 8 << 20
+
+// errInvalidJSON and errInvalidBody mark request bodies that could not be decoded at all
+var (
+	errInvalidJSON = errors.New("invalid JSON")
+	errInvalidBody = errors.New("invalid request body")
+)
+
+// withBodyLimit caps the request body at maxRequestKB; reading past it fails with
+// an *http.MaxBytesError, which writeTooLarge answers
+func (s *Server) withBodyLimit(next http.HandlerFunc) http.HandlerFunc {
+	if s.cfg.MaxRequestKB <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(s.cfg.MaxRequestKB)<<10)
+		next(w, r)
+	}
+}
+
+// writeTooLarge answers 413 if err came from a body over maxRequestKB, reporting whether it did
+func (s *Server) writeTooLarge(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	writeError(w, http.StatusRequestEntityTooLarge, codeInvalidField, "code", fmt.Sprintf("requests are limited to %d KB, sources and form fields included", s.cfg.MaxRequestKB))
+	return true
+}
+
+// bodyError keeps a read error caused by the size limit and replaces any other with fallback
+func bodyError(err, fallback error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return fallback
+}
+
+// decodeCompileRequest reads a compile request from r's body: JSON by default, the
+// bare source for text/plain with the other fields in the query string, or HTML
+// form fields named like the JSON ones
+func decodeCompileRequest(r *http.Request) (CompileRequest, error) {
+	var req CompileRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	br := bufio.NewReader(r.Body)
+	r.Body = io.NopCloser(br)
+	if mediaType == "application/x-www-form-urlencoded" {
+		// curl -d sends JSON as a form unless told otherwise
+		if b, _ := br.Peek(1); len(b) == 1 && b[0] == '{' {
+			mediaType = "application/json"
+		}
+	}
+	switch mediaType {
+	case "text/plain":
+		code, err := io.ReadAll(r.Body)
+		if err != nil {
+			return req, bodyError(err, errInvalidBody)
+		}
+		if err := compileRequestFromValues(&req, r.URL.Query()); err != nil {
+			return req, err
+		}
+		req.Code = string(code)
+		return req, nil
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return req, bodyError(err, errInvalidBody)
+		}
+		return req, compileRequestFromValues(&req, r.Form)
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxFormMemory); err != nil {
+			return req, bodyError(err, errInvalidBody)
+		}
+		if err := compileRequestFromValues(&req, r.Form); err != nil {
+			return req, err
+		}
+		// curl -F code=@main.c sends the source as a file
+		if files := r.MultipartForm.File["code"]; req.Code == "" && len(files) > 0 {
+			f, err := files[0].Open()
+			if err != nil {
+				return req, errInvalidBody
+			}
+			defer f.Close()
+			code, err := io.ReadAll(f)
+			if err != nil {
+				return req, errInvalidBody
+			}
+			req.Code = string(code)
+		}
+		return req, nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, bodyError(err, errInvalidJSON)
+	}
+	return req, nil
+}
+
+// compileRequestFromValues fills req from form or query values. Lists repeat their
+// key, e.g. args=-O2&args=-g, and defines are given as NAME or NAME=VALUE.
+func compileRequestFromValues(req *CompileRequest, v url.Values) error {
+	req.Code = v.Get("code")
+	req.Type = v.Get("type")
+	req.Args = v["args"]
+	req.IncludeDirs = v["includeDirs"]
+	req.Cache = v.Get("cache")
+	req.Warnings = v.Get("warnings")
+	req.PreviewID = v.Get("previewId")
+	req.Profile = v.Get("profile")
+	req.Alias = v.Get("alias")
+	req.Output = v.Get("output")
+	req.IdempotencyKey = v.Get("idempotencyKey")
+	for _, d := range v["defines"] {
+		if req.Defines == nil {
+			req.Defines = make(map[string]string)
+		}
+		name, value, _ := strings.Cut(d, "=")
+		req.Defines[name] = value
+	}
+	for field, dst := range map[string]*bool{"network": &req.Network, "wat": &req.WAT, "separateDebug": &req.SeparateDebug, "sizeReport": &req.SizeReport, "preview": &req.Preview} {
+		if s := v.Get(field); s != "" {
+			// checkboxes of HTML forms send "on"
+			b, err := strconv.ParseBool(s)
+			if s == "on" {
+				b, err = true, nil
+			}
+			if err != nil {
+				return fieldErrorf(field, "%s must be true or false", field)
+			}
+			*dst = b
+		}
+	}
+	if s := v.Get("ttlHours"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fieldErrorf("ttlHours", "ttlHours must be an integer")
+		}
+		req.TTLHours = n
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// defaultHookTimeout bounds a post hook that sets no timeoutSecs
+const defaultHookTimeout = time.Minute
+
+// Failure policies of post hooks
+const (
+	hookFail   = "fail" // the job fails; the default
+	hookIgnore = "ignore"
+)
+
+// hookTimeout returns how long hook h may run
+func (h PostHook) hookTimeout() time.Duration {
+	if h.TimeoutSecs > 0 {
+		return time.Duration(h.TimeoutSecs) * time.Second
+	}
+	return defaultHookTimeout
+}
+
+// runCommandHooks runs the command post hooks in jobDir, sandboxed like the compile,
+// with the names of the build's outputs appended to each command. Files the hooks
+// add, such as signatures, are published with the outputs. A failing hook stops
+// the job unless its onFailure is "ignore".
+func (s *Server) runCommandHooks(ctx context.Context, id, jobDir string, outputs []string, logw io.Writer) error {
+	for _, h := range s.cfg.PostHooks {
+		if len(h.Command) == 0 {
+			continue
+		}
+		err := s.runCommandHook(ctx, jobDir, h, outputs, logw)
+		if err == nil {
+			continue
+		}
+		if h.OnFailure == hookIgnore {
+			log.Printf("job %s: post hook %s: %v", id, h.Name, err)
+			continue
+		}
+		return fmt.Errorf("post hook %s: %w", h.Name, err)
+	}
+	return nil
+}
+
+// runCommandHook runs one command hook under its own timeout
+func (s *Server) runCommandHook(ctx context.Context, jobDir string, h PostHook, outputs []string, logw io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, h.hookTimeout())
+	defer cancel()
+	argv := append(append([]string{}, h.Command...), outputs...)
+	cmd, err := s.compileCommand(ctx, jobDir, argv, false)
+	if err != nil {
+		return err
+	}
+	out, err := s.runLogged(cmd, logw)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", h.hookTimeout())
+	}
+	if err != nil {
+		if msg := firstLine(out.combined()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// runURLHooks posts the published artifacts of job id to the URL post hooks. A
+// failing hook stops the job unless its onFailure is "ignore".
+func (s *Server) runURLHooks(ctx context.Context, ev PostHookEvent) error {
+	body, _ := json.Marshal(ev)
+	for _, h := range s.cfg.PostHooks {
+		if h.URL == "" {
+			continue
+		}
+		err := postHook(ctx, h, body)
+		if err == nil {
+			continue
+		}
+		if h.OnFailure == hookIgnore {
+			log.Printf("job %s: post hook %s: %v", ev.ID, h.Name, err)
+			continue
+		}
+		return fmt.Errorf("post hook %s: %w", h.Name, err)
+	}
+	return nil
+}
+
+// postHook delivers body to the URL of h, which must answer 2xx in time
+func postHook(ctx context.Context, h PostHook, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, h.hookTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", h.URL, resp.Status)
+	}
+	return nil
+}
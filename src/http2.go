@@ -0,0 +1,41 @@
+package src
+
+import (
+	"net"
+	"net/http"
+)
+
+// httpProtocols returns the protocols the API and artifact listeners speak:
+// HTTP/1.1, HTTP/2 negotiated over TLS unless disabled, and cleartext HTTP/2
+// (h2c) when enabled for reverse proxies
+func (s *Server) httpProtocols() *http.Protocols {
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	p.SetHTTP2(s.cfg.HTTP2)
+	p.SetUnencryptedHTTP2(s.cfg.H2C)
+	return p
+}
+
+// serve runs srv on ln, over TLS when tlsCertFile is set
+func (s *Server) serve(srv *http.Server, ln net.Listener) error {
+	srv.Protocols = s.httpProtocols()
+	if s.cfg.TLSCertFile != "" {
+		return srv.ServeTLS(ln, s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+	}
+	return srv.Serve(ln)
+}
+
+// withH2CGuard only lets trusted proxies use cleartext HTTP/2; h2c has no
+// negotiation, so it cannot be refused to anyone else on the listener itself
+func (s *Server) withH2CGuard(next http.Handler) http.Handler {
+	if !s.cfg.H2C {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && r.TLS == nil && !s.fromTrustedProxy(r) {
+			writeError(w, http.StatusForbidden, codeForbidden, "", "cleartext HTTP/2 is only accepted from trusted proxies")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
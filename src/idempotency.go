@@ -0,0 +1,232 @@
+package src
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxIdempotencyKeyLen bounds the size of client supplied idempotency keys
+const maxIdempotencyKeyLen = 255
+
+// idempotencyEntry records the outcome of a request made with an idempotency key
+type idempotencyEntry struct {
+	fingerprint string
+	done        chan struct{} // closed once the original request finished
+	recorded    bool          // response below is replayable
+	status      int
+	header      http.Header
+	body        []byte
+	artifact    string // replayed instead of body: the published module a wasm body was served from
+	expires     time.Time
+}
+
+// withIdempotency replays the original response for retried requests carrying the same key
+func (s *Server) withIdempotency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.IdempotencyTTLHours <= 0 || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			if s.writeTooLarge(w, err) {
+				return
+			}
+			writeError(w, http.StatusBadRequest, codeInvalidJSON, "", "failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+		if key == "" {
+			// Fall back to the request field for clients that cannot set headers
+			var probe struct {
+				IdempotencyKey string `json:"idempotencyKey"`
+			}
+			_ = json.Unmarshal(body, &probe)
+			key = strings.TrimSpace(probe.IdempotencyKey)
+		}
+		if key == "" {
+			// text/plain bodies carry fields in the query, forms in the body
+			fields := r.URL.Query()
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+				fields, _ = url.ParseQuery(string(body))
+			}
+			key = strings.TrimSpace(fields.Get("idempotencyKey"))
+		}
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			writeError(w, http.StatusBadRequest, codeInvalidField, "idempotencyKey", "idempotency key too long")
+			return
+		}
+		sum := sha256.Sum256(body)
+		fp := hex.EncodeToString(sum[:])
+
+		for {
+			e, owner, err := s.beginIdempotent(key, fp)
+			if err != nil {
+				writeError(w, http.StatusUnprocessableEntity, codeIdempotencyConflict, "idempotencyKey", err.Error())
+				return
+			}
+			if owner {
+				rec := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+				next(rec, r)
+				s.finishIdempotent(key, e, rec)
+				writeResponse(w, rec.status, rec.header, rec.body.Bytes())
+				return
+			}
+			select {
+			case <-e.done:
+			case <-r.Context().Done():
+				writeError(w, http.StatusRequestTimeout, codeCanceled, "", "request canceled")
+				return
+			}
+			if e.recorded && s.replayIdempotent(w, r, key, e) {
+				return
+			}
+			// The original attempt failed transiently; retry as the new owner
+		}
+	}
+}
+
+// beginIdempotent returns the entry for key, reporting whether the caller owns its execution
+func (s *Server) beginIdempotent(key, fingerprint string) (*idempotencyEntry, bool, error) {
+	s.idemMu.Lock()
+	defer s.idemMu.Unlock()
+	if e, ok := s.idem[key]; ok && (!e.recorded || time.Now().Before(e.expires)) {
+		if e.fingerprint != fingerprint {
+			return nil, false, fmt.Errorf("idempotency key reused with a different request")
+		}
+		return e, false, nil
+	}
+	e := &idempotencyEntry{fingerprint: fingerprint, done: make(chan struct{})}
+	s.idem[key] = e
+	return e, true, nil
+}
+
+// finishIdempotent records a replayable response, or forgets the key after a transient failure
+func (s *Server) finishIdempotent(key string, e *idempotencyEntry, rec *responseRecorder) {
+	s.idemMu.Lock()
+	defer s.idemMu.Unlock()
+	if rec.status >= 500 || rec.status == http.StatusRequestTimeout {
+		delete(s.idem, key)
+	} else {
+		e.recorded = true
+		e.status = rec.status
+		e.header = rec.header.Clone()
+		if id := rec.header.Get("X-Job-Id"); rec.header.Get("Content-Type") == "application/wasm" && id != "" {
+			// binary bodies are not kept in memory but served again from the artifact
+			e.artifact = filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, id, s.cfg.OutputName+".wasm")
+		} else {
+			e.body = append([]byte(nil), rec.body.Bytes()...)
+			s.idemBytes += len(e.body)
+		}
+		e.expires = time.Now().Add(time.Duration(s.cfg.IdempotencyTTLHours) * time.Hour)
+		s.evictIdempotency()
+	}
+	close(e.done)
+}
+
+// replayIdempotent answers r with the response recorded in e. It fails when the
+// artifact a wasm body is replayed from is gone, after forgetting the key.
+func (s *Server) replayIdempotent(w http.ResponseWriter, r *http.Request, key string, e *idempotencyEntry) bool {
+	if e.artifact == "" {
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeResponse(w, e.status, e.header, e.body)
+		return true
+	}
+	f, err := os.Open(e.artifact)
+	if err != nil {
+		s.idemMu.Lock()
+		if s.idem[key] == e {
+			s.dropIdempotent(key, e)
+		}
+		s.idemMu.Unlock()
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	for k, v := range e.header {
+		w.Header()[k] = v
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Idempotent-Replayed", "true")
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+	return true
+}
+
+// evictIdempotency drops the oldest recorded responses while more than
+// idempotencyMaxKeys or idempotencyMaxMB are kept; s.idemMu must be held
+func (s *Server) evictIdempotency() {
+	maxBytes := s.cfg.IdempotencyMaxMB << 20
+	for len(s.idem) > s.cfg.IdempotencyMaxKeys || s.idemBytes > maxBytes {
+		var oldestKey string
+		var oldest *idempotencyEntry
+		for k, e := range s.idem {
+			if e.recorded && (oldest == nil || e.expires.Before(oldest.expires)) {
+				oldestKey, oldest = k, e
+			}
+		}
+		if oldest == nil {
+			// only requests still running are left
+			return
+		}
+		s.dropIdempotent(oldestKey, oldest)
+	}
+}
+
+// dropIdempotent forgets key, recorded as e; s.idemMu must be held
+func (s *Server) dropIdempotent(key string, e *idempotencyEntry) {
+	delete(s.idem, key)
+	s.idemBytes -= len(e.body)
+}
+
+// pruneIdempotency drops recorded responses past their TTL
+func (s *Server) pruneIdempotency() {
+	s.idemMu.Lock()
+	defer s.idemMu.Unlock()
+	now := time.Now()
+	for k, e := range s.idem {
+		if e.recorded && now.After(e.expires) {
+			s.dropIdempotent(k, e)
+		}
+	}
+}
+
+// responseRecorder buffers a handler's response so it can be stored and replayed
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+
+func (r *responseRecorder) WriteHeader(status int) { r.status = status }
+
+// writeResponse copies a recorded response to w
+func writeResponse(w http.ResponseWriter, status int, header http.Header, body []byte) {
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
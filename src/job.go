@@ -0,0 +1,166 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// parseLang normalizes the requested source language, defaulting to c
+func parseLang(t string) (string, bool) {
+	lang := strings.ToLower(strings.TrimSpace(t))
+	if lang != "c" && lang != "cpp" && lang != "cc" && lang != "c++" && lang != "" {
+		return "", false
+	}
+	if lang == "" {
+		// default to c
+		lang = "c"
+	}
+	return lang, true
+}
+
+// sourceName returns the file name submitted code is written to
+func sourceName(lang string) string {
+	if lang != "c" {
+		return "main.cpp"
+	}
+	return "main.c"
+}
+
+// admitJob applies resource gating before a job starts and returns the function
+// releasing its reservation; memScale scales the job's memory estimate. On failure
+// the error response has been written.
+func (s *Server) admitJob(w http.ResponseWriter, r *http.Request, memScale float64) (func(), bool) {
+	// Resource gating by cgroup memory budget if enabled
+	if !s.cfg.EnableResourceGating {
+		return func() {}, true
+	}
+	if err := s.ensureMemBudget(); err != nil {
+		writeInternalError(w, fmt.Errorf("resource gating init failed: %w", err))
+		return nil, false
+	}
+	est := s.cfg.JobMemoryEstimateMB * 1024 * 1024
+	if est <= 0 {
+		est = 256 * 1024 * 1024
+	}
+	est = int64(float64(est) * memScale)
+	if err := s.acquireMemory(r.Context(), est); err != nil {
+		writeError(w, http.StatusRequestTimeout, codeCanceled, "", "resource wait canceled")
+		return nil, false
+	}
+	return func() { s.releaseMemory(est) }, true
+}
+
+// jobTimeline records the lifecycle events of a job as it is handled, starting with "received"
+type jobTimeline struct {
+	start  time.Time
+	events []JobEvent
+}
+
+// newJobTimeline starts the timeline of a job received now
+func newJobTimeline() *jobTimeline {
+	t := &jobTimeline{start: time.Now()}
+	t.add("received")
+	return t
+}
+
+// add records that the job reached event
+func (t *jobTimeline) add(event string) {
+	now := time.Now()
+	t.events = append(t.events, JobEvent{Event: event, At: now.UTC(), OffsetMs: now.Sub(t.start).Milliseconds()})
+}
+
+// list returns the events recorded so far
+func (t *jobTimeline) list() []JobEvent {
+	return slices.Clone(t.events)
+}
+
+// setServerTiming reports how long a job waited for admission and how long it ran
+// as a Server-Timing header, so frontends can tell queueing from compiling
+func setServerTiming(w http.ResponseWriter, queued, ran time.Duration) {
+	w.Header().Set("Server-Timing", fmt.Sprintf(`queue;dur=%d;desc="Waiting for a build slot", compile;dur=%d;desc="Compiling"`,
+		queued.Milliseconds(), ran.Milliseconds()))
+}
+
+// newJobDir creates the workspace jobs/<id> and writes the submitted source into it
+func (s *Server) newJobDir(id, lang, code string) (string, error) {
+	jobDir := filepath.Join(s.cfg.BaseDir, s.cfg.JobsDir, id)
+	if s.cfg.OverlayJobDirs {
+		if err := mountJobOverlay(jobDir, s.cfg.JobSkeletonDir, s.cfg.JobScratchMB); err != nil {
+			return "", err
+		}
+	} else if err := os.MkdirAll(jobDir, 0o755); err != nil {
+		return "", err
+	}
+	srcPath := filepath.Join(jobDir, sourceName(lang))
+	if err := os.WriteFile(srcPath, []byte(code), 0o644); err != nil {
+		s.removeJobDir(jobDir)
+		return "", err
+	}
+	// The compile user writes its outputs next to the source
+	if s.cfg.CompileUID >= 0 {
+		if err := os.Chown(jobDir, s.cfg.CompileUID, s.cfg.CompileGID); err != nil {
+			s.removeJobDir(jobDir)
+			return "", err
+		}
+	}
+	// Set explicitly: mkdir applies the umask, and chown may drop the setgid bit
+	mode, _ := parseMode(s.cfg.JobDirMode)
+	if err := os.Chmod(jobDir, mode); err != nil {
+		s.removeJobDir(jobDir)
+		return "", err
+	}
+	return jobDir, nil
+}
+
+// prepareJobsDir places the jobs directory on a size-capped tmpfs when configured,
+// falling back to disk if that is not possible
+func (s *Server) prepareJobsDir() {
+	if s.cfg.JobsTmpfsMB <= 0 {
+		return
+	}
+	dir := filepath.Join(s.cfg.BaseDir, s.cfg.JobsDir)
+	mounted, err := mountJobsTmpfs(dir, s.cfg.JobsTmpfsMB)
+	switch {
+	case err != nil:
+		log.Printf("warning: jobs dir stays on disk: %v", err)
+	case mounted:
+		log.Printf("mounted %d MB tmpfs on %s", s.cfg.JobsTmpfsMB, dir)
+	default:
+		log.Printf("jobs dir %s is already a tmpfs; jobsTmpfsMB not applied", dir)
+	}
+}
+
+// removeJobDir discards a job workspace, unmounting it first when it is an overlay
+func (s *Server) removeJobDir(jobDir string) {
+	if s.cfg.OverlayJobDirs {
+		if err := unmountJobOverlay(jobDir); err != nil {
+			log.Printf("remove job dir %s: %v", jobDir, err)
+			return
+		}
+	}
+	_ = os.RemoveAll(jobDir)
+	removePrivateCache(jobDir)
+}
+
+// skeletonEntries lists the top-level names the job skeleton contributes to every
+// overlay job dir; they are never published as outputs
+func (s *Server) skeletonEntries() []string {
+	if !s.cfg.OverlayJobDirs {
+		return nil
+	}
+	entries, err := os.ReadDir(s.cfg.JobSkeletonDir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
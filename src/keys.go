@@ -0,0 +1,171 @@
+package src
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix marks API keys, so leaked ones are easy to recognize
+const apiKeyPrefix = "esk_"
+
+// apiKey is a stored API key; only the hash of its secret is kept
+type apiKey struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+// apiKeysPath returns the file API keys are persisted in
+func (s *Server) apiKeysPath() string {
+	return filepath.Join(s.cfg.BaseDir, s.cfg.APIKeysFile)
+}
+
+// loadAPIKeys reads the persisted API keys; a missing file means none
+func (s *Server) loadAPIKeys() error {
+	b, err := os.ReadFile(s.apiKeysPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var keys []apiKey
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	s.keysMu.Lock()
+	s.apiKeys = keys
+	s.keysMu.Unlock()
+	return nil
+}
+
+// saveAPIKeys persists keys in one step; the caller holds keysMu
+func (s *Server) saveAPIKeys(keys []apiKey) error {
+	b, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the file holds no secrets, but key names may say who the tenants are
+	return writeFileAtomic(s.apiKeysPath(), b, 0o600)
+}
+
+// newAPIKeyID returns a random key ID no current key has; s.keysMu must be held
+func (s *Server) newAPIKeyID() (string, error) {
+	for {
+		id, err := randomID(8) // 16 hex chars
+		if err != nil {
+			return "", err
+		}
+		if !slices.ContainsFunc(s.apiKeys, func(k apiKey) bool { return k.ID == id }) {
+			return id, nil
+		}
+	}
+}
+
+// hashAPIKey returns the stored form of an API key secret
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// validAPIKey reports whether r bears a current API key
+func (s *Server) validAPIKey(r *http.Request) bool {
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(secret, apiKeyPrefix) {
+		return false
+	}
+	hash := []byte(hashAPIKey(secret))
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	for _, k := range s.apiKeys {
+		if subtle.ConstantTimeCompare(hash, []byte(k.Hash)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAPIKeys serves GET /admin/keys, listing API keys without their secrets,
+// and POST, which creates one named {"name"} and answers its secret, once
+func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.keysMu.Lock()
+		list := make([]APIKey, 0, len(s.apiKeys))
+		for _, k := range s.apiKeys {
+			list = append(list, k.APIKey)
+		}
+		s.keysMu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidJSON, "", "invalid JSON")
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" || len(req.Name) > 100 {
+			writeError(w, http.StatusBadRequest, codeInvalidField, "name", "name must be 1 to 100 characters")
+			return
+		}
+		secret, err := randomID(24)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		secret = apiKeyPrefix + secret
+		s.keysMu.Lock()
+		defer s.keysMu.Unlock()
+		id, err := s.newAPIKeyID()
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		key := apiKey{APIKey: APIKey{ID: id, Name: req.Name, Created: time.Now().UTC()}, Hash: hashAPIKey(secret)}
+		keys := append(slices.Clone(s.apiKeys), key)
+		if err := s.saveAPIKeys(keys); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		s.apiKeys = keys
+		created := key.APIKey
+		created.Key = secret
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(created)
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// handleAPIKey serves DELETE /admin/keys/{id}, revoking an API key at once
+func (s *Server) handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w)
+		return
+	}
+	id := r.PathValue("id")
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	keys := slices.DeleteFunc(slices.Clone(s.apiKeys), func(k apiKey) bool { return k.ID == id })
+	if len(keys) == len(s.apiKeys) {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no key "+id)
+		return
+	}
+	if err := s.saveAPIKeys(keys); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	s.apiKeys = keys
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,213 @@
+//go:build linux
+
+package src
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock system calls share these numbers on every architecture
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+)
+
+// Landlock filesystem access rights (ABI 1 unless noted)
+const (
+	llExecute    = 1 << 0
+	llWriteFile  = 1 << 1
+	llReadFile   = 1 << 2
+	llReadDir    = 1 << 3
+	llAllABI1    = 1<<13 - 1 // every right up to MAKE_SYM
+	llRefer      = 1 << 13   // ABI 2
+	llTruncate   = 1 << 14   // ABI 3
+	llReadAccess = llExecute | llReadFile | llReadDir
+)
+
+const (
+	landlockRulePathBeneath      = 1
+	landlockCreateRulesetVersion = 1 << 0
+	prSetNoNewPrivs              = 38
+	oPath                        = 0x200000 // O_PATH, missing from package syscall
+)
+
+// landlockSpecEnv carries the landlockSpec from the daemon to the helper
+const landlockSpecEnv = "EMCC_SANDBOXD_LANDLOCK"
+
+// landlockFileSizeLimit mirrors the nsjail --rlimit_fsize of jailed compiles
+const landlockFileSizeLimit uint64 = 256 * 1024 * 1024
+
+// landlockSpec is what the parent passes to the sandbox-exec helper
+type landlockSpec struct {
+	ReadWrite []string `json:"rw"`
+	ReadOnly  []string `json:"ro"`
+	CPUSecs   uint64   `json:"cpuSecs"`
+}
+
+// landlockABI returns the Landlock ABI version of the running kernel, or an error if
+// Landlock is unavailable
+func landlockABI() (int, error) {
+	v, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0, fmt.Errorf("landlock unavailable: %w", errno)
+	}
+	return int(v), nil
+}
+
+// landlockCommand runs argv through the sandbox-exec helper, which confines it to
+// jobDir, the toolchain and system directories before executing it
+func (s *Server) landlockCommand(ctx context.Context, jobDir string, argv []string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(jobDir)
+	if err != nil {
+		return nil, err
+	}
+	spec := landlockSpec{
+		ReadWrite: []string{abs, "/dev/null"},
+		ReadOnly:  append(append([]string{"/dev/urandom", "/proc", "/etc/ld.so.cache"}, s.cfg.NsJailReadOnlyMounts...), s.toolchainDirs()...),
+		CPUSecs:   uint64(s.cpuLimitSecs(ctx)),
+	}
+	if s.cfg.PCHDir != "" {
+		spec.ReadOnly = append(spec.ReadOnly, s.cfg.PCHDir)
+	}
+	if cache := s.jobCacheDir(jobDir); cache != "" {
+		spec.ReadWrite = append(spec.ReadWrite, cache)
+	}
+	if s.cfg.CcacheDir != "" {
+		spec.ReadWrite = append(spec.ReadWrite, s.cfg.CcacheDir)
+	}
+	b, _ := json.Marshal(spec)
+	cmd := exec.CommandContext(ctx, self, append([]string{SandboxExecArg, "--"}, argv...)...)
+	cmd.Dir = jobDir
+	// Temporary files stay inside the job directory, the only writable tree
+	cmd.Env = []string{landlockSpecEnv + "=" + string(b), "TMPDIR=" + filepath.Join(abs, ".tmp")}
+	if err := os.MkdirAll(filepath.Join(jobDir, ".tmp"), 0o755); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// SandboxExec is the body of the sandbox-exec helper: it applies rlimits,
+// no_new_privs and the Landlock ruleset from the environment, then replaces itself
+// with argv. It only returns on failure.
+func SandboxExec(argv []string) int {
+	var spec landlockSpec
+	if err := json.Unmarshal([]byte(os.Getenv(landlockSpecEnv)), &spec); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox-exec: bad spec: %v\n", err)
+		return 126
+	}
+	os.Unsetenv(landlockSpecEnv)
+	if len(argv) == 0 {
+		fmt.Fprintln(os.Stderr, "sandbox-exec: no command")
+		return 126
+	}
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox-exec: %v\n", err)
+		return 127
+	}
+	// Landlock and no_new_privs apply to the calling thread, which exec then carries over
+	runtime.LockOSThread()
+	if err := restrictSelf(spec); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox-exec: %v\n", err)
+		return 126
+	}
+	err = syscall.Exec(path, argv, os.Environ())
+	fmt.Fprintf(os.Stderr, "sandbox-exec: %v\n", err)
+	return 126
+}
+
+// restrictSelf confines the calling thread according to spec
+func restrictSelf(spec landlockSpec) error {
+	limits := map[int]uint64{
+		syscall.RLIMIT_FSIZE: landlockFileSizeLimit,
+		syscall.RLIMIT_CORE:  0,
+	}
+	if spec.CPUSecs > 0 {
+		limits[syscall.RLIMIT_CPU] = spec.CPUSecs
+	}
+	for res, v := range limits {
+		var cur syscall.Rlimit
+		if err := syscall.Getrlimit(res, &cur); err == nil && cur.Max < v {
+			v = cur.Max // cannot be raised without privileges
+		}
+		if err := syscall.Setrlimit(res, &syscall.Rlimit{Cur: v, Max: v}); err != nil {
+			return fmt.Errorf("setrlimit %d: %w", res, err)
+		}
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("no_new_privs: %w", errno)
+	}
+
+	abi, err := landlockABI()
+	if err != nil {
+		return err
+	}
+	handled := uint64(llAllABI1)
+	if abi >= 2 {
+		handled |= llRefer
+	}
+	if abi >= 3 {
+		handled |= llTruncate
+	}
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&handled)), unsafe.Sizeof(handled), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock_create_ruleset: %w", errno)
+	}
+	defer syscall.Close(int(fd))
+	for _, p := range spec.ReadWrite {
+		if err := landlockAllow(int(fd), p, handled); err != nil {
+			return err
+		}
+	}
+	for _, p := range spec.ReadOnly {
+		if err := landlockAllow(int(fd), p, llReadAccess); err != nil {
+			return err
+		}
+	}
+	if _, _, errno := syscall.Syscall(sysLandlockRestrictSelf, fd, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock_restrict_self: %w", errno)
+	}
+	return nil
+}
+
+// landlockAllow adds a rule granting access beneath path; missing paths are skipped
+func landlockAllow(rulesetFd int, path string, access uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		if err == syscall.ENOENT {
+			return nil
+		}
+		return fmt.Errorf("landlock %s: %w", path, err)
+	}
+	defer syscall.Close(fd)
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("landlock %s: %w", path, err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		// directory-only rights are invalid on files
+		access &= llExecute | llWriteFile | llReadFile | llTruncate
+	}
+	// struct landlock_path_beneath_attr is packed: the access mask, then the fd
+	var attr [12]byte
+	binary.NativeEndian.PutUint64(attr[:8], access)
+	binary.NativeEndian.PutUint32(attr[8:], uint32(fd))
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(rulesetFd), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr[0])), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock_add_rule %s: %w", path, errno)
+	}
+	return nil
+}
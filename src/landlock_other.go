@@ -0,0 +1,27 @@
+//go:build !linux
+
+package src
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// landlockABI reports that Landlock, a Linux security module, is unavailable
+func landlockABI() (int, error) {
+	return 0, fmt.Errorf("landlock is not available on %s", runtime.GOOS)
+}
+
+// landlockCommand is unavailable outside Linux
+func (s *Server) landlockCommand(ctx context.Context, jobDir string, argv []string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("landlock is not available on %s", runtime.GOOS)
+}
+
+// SandboxExec is unavailable outside Linux
+func SandboxExec(argv []string) int {
+	fmt.Fprintf(os.Stderr, "sandbox-exec: landlock is not available on %s\n", runtime.GOOS)
+	return 126
+}
@@ -0,0 +1,157 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// minShedSamples is the number of recent outcomes needed before the failure rate is trusted
+const minShedSamples = 10
+
+// loadShedder tracks recent compile health to decide when to reject new work
+type loadShedder struct {
+	mu       sync.Mutex
+	inflight int
+	outcomes []shedOutcome
+}
+
+// shedOutcome is the result of one finished compile request
+type shedOutcome struct {
+	at     time.Time
+	took   time.Duration
+	failed bool
+}
+
+// maxRetryAfter bounds the Retry-After derived from throughput, so a stall does
+// not send clients away for good
+const maxRetryAfter = 5 * time.Minute
+
+// withLoadShedding rejects compile requests with 503 while the service is unhealthy;
+// anonymous callers are shed first, at shedAnonymousShare of each threshold
+func (s *Server) withLoadShedding(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			w.Header().Set("Retry-After", strconv.Itoa(s.cfg.ShedRetryAfterSecs))
+			writeError(w, http.StatusServiceUnavailable, codeDraining, "", "server draining")
+			return
+		}
+		if s.cfg.LoadShedEnabled {
+			share := 1.0
+			if s.roleOf(r) == roleAnonymous {
+				share = s.cfg.ShedAnonymousShare
+			}
+			if reason := s.shedReason(share); reason != "" {
+				log.Printf("shedding %s %s: %s", r.Method, r.URL.Path, reason)
+				q := s.queueState()
+				w.Header().Set("Retry-After", strconv.Itoa(q.RetryAfterSecs))
+				writeAPIError(w, http.StatusServiceUnavailable, APIError{Code: codeOverloaded, Message: "server overloaded: " + reason, Queue: &q})
+				return
+			}
+		}
+		// outcomes are tracked even when shedding is off; alerting watches them too
+		s.shed.mu.Lock()
+		s.shed.inflight++
+		s.shed.mu.Unlock()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next(sw, r)
+
+		s.shed.mu.Lock()
+		s.shed.inflight--
+		s.shed.outcomes = append(s.shed.outcomes, shedOutcome{at: time.Now(), took: time.Since(start), failed: sw.status >= 500})
+		s.shed.mu.Unlock()
+	}
+}
+
+// recentOutcomes returns the in-flight count and the failed and total compile
+// outcomes within shedWindowSecs
+func (s *Server) recentOutcomes() (inflight, failed, samples int) {
+	window := time.Duration(s.cfg.ShedWindowSecs) * time.Second
+	s.shed.mu.Lock()
+	defer s.shed.mu.Unlock()
+	// drop outcomes that fell out of the window so the rate recovers once failures stop
+	cutoff := time.Now().Add(-window)
+	i := 0
+	for i < len(s.shed.outcomes) && s.shed.outcomes[i].at.Before(cutoff) {
+		i++
+	}
+	s.shed.outcomes = s.shed.outcomes[i:]
+	for _, o := range s.shed.outcomes {
+		if o.failed {
+			failed++
+		}
+	}
+	return s.shed.inflight, failed, len(s.shed.outcomes)
+}
+
+// queueState describes the load for a shed response. The compiles finished within
+// shedWindowSecs give the average duration; with the in-flight ones sharing the
+// machine, a slot frees about every average duration divided by their number,
+// which yields the wait for a slot under shedMaxQueueDepth. Without finished
+// compiles to go by, clients are told to retry after shedRetryAfterSecs.
+func (s *Server) queueState() QueueState {
+	window := time.Duration(s.cfg.ShedWindowSecs) * time.Second
+	inflight, _, samples := s.recentOutcomes()
+	q := QueueState{Depth: inflight, MaxDepth: s.cfg.ShedMaxQueueDepth, RetryAfterSecs: s.cfg.ShedRetryAfterSecs}
+	if samples == 0 || window <= 0 {
+		return q
+	}
+	s.shed.mu.Lock()
+	var total time.Duration
+	for _, o := range s.shed.outcomes {
+		total += o.took
+	}
+	s.shed.mu.Unlock()
+	avg := total / time.Duration(samples)
+	q.CompletedPerMin = float64(samples) / window.Minutes()
+	q.AvgDurationMs = avg.Milliseconds()
+	// shedding for other reasons waits for one slot, in which in-flight work settles
+	ahead := max(1, inflight-s.cfg.ShedMaxQueueDepth+1)
+	wait := avg * time.Duration(ahead) / time.Duration(max(1, inflight))
+	if wait = min(wait, maxRetryAfter); wait < time.Second {
+		wait = time.Second
+	}
+	q.EstimatedWaitMs = wait.Milliseconds()
+	q.RetryAfterSecs = int((wait + time.Second - 1) / time.Second)
+	return q
+}
+
+// shedReason returns why new work should be rejected once load reaches share of
+// the thresholds, or "" if it can be accepted
+func (s *Server) shedReason(share float64) string {
+	inflight, failed, samples := s.recentOutcomes()
+	if s.cfg.ShedMaxQueueDepth > 0 && float64(inflight) >= share*float64(s.cfg.ShedMaxQueueDepth) {
+		return fmt.Sprintf("queue depth %d", inflight)
+	}
+	if s.cfg.ShedMaxFailureRate > 0 && samples >= minShedSamples {
+		if rate := float64(failed) / float64(samples); rate > share*s.cfg.ShedMaxFailureRate {
+			return fmt.Sprintf("failure rate %.0f%%", rate*100)
+		}
+	}
+	if s.cfg.ShedMaxMemoryPercent > 0 {
+		max, err := readCgroupMemoryMax(s.cfg.CgroupV2Root)
+		if err == nil && max > 0 {
+			cur, err := readCgroupMemoryCurrent(s.cfg.CgroupV2Root)
+			if err == nil && float64(cur*100) >= share*float64(max*int64(s.cfg.ShedMaxMemoryPercent)) {
+				return fmt.Sprintf("memory at %d%% of limit", cur*100/max)
+			}
+		}
+	}
+	return ""
+}
+
+// statusWriter remembers the status code written by a handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,105 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+)
+
+// handleMatrix serves POST /matrix: the same source compiled with each of several
+// arg sets, one after the other through the compile pipeline, and a comparison of
+// the results
+func (s *Server) handleMatrix(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	var req MatrixRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if s.writeTooLarge(w, err) {
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, "", "invalid JSON")
+		return
+	}
+	if len(req.Variants) == 0 {
+		writeError(w, http.StatusBadRequest, codeMissingField, "variants", "variants is required")
+		return
+	}
+	if len(req.Variants) > s.cfg.MatrixMaxVariants {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "variants", fmt.Sprintf("at most %d variants are allowed", s.cfg.MatrixMaxVariants))
+		return
+	}
+	// every variant is a compile of its own; a key would make them all the first,
+	// and an alias would end up naming whichever ran last
+	req.IdempotencyKey = ""
+	req.Alias = ""
+	resp := MatrixResponse{Results: make([]MatrixResult, 0, len(req.Variants)), Smallest: -1, Fastest: -1}
+	for i, variant := range req.Variants {
+		creq := req.CompileRequest
+		creq.Args = append(append([]string{}, req.Args...), variant...)
+		body, _ := json.Marshal(creq)
+		rec := httptest.NewRecorder()
+		vr := r.Clone(r.Context())
+		vr.Body = io.NopCloser(bytes.NewReader(body))
+		vr.ContentLength = int64(len(body))
+		s.HandleCompile(rec, vr)
+
+		var envelope ErrorResponse
+		if json.Unmarshal(rec.Body.Bytes(), &envelope) == nil && envelope.Error.Code != "" {
+			// request errors such as an invalid field apply to every variant alike
+			copyRecorded(w, rec)
+			return
+		}
+		res := MatrixResult{Args: variant}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res.Result); err != nil {
+			writeInternalError(w, fmt.Errorf("variant %d: %w", i, err))
+			return
+		}
+		if res.Result.OK {
+			res.Sizes, res.TotalBytes = s.artifactSizes(res.Result.ID)
+			if resp.Smallest < 0 || res.TotalBytes < resp.Results[resp.Smallest].TotalBytes {
+				resp.Smallest = i
+			}
+			if resp.Fastest < 0 || res.Result.CompileMs < resp.Results[resp.Fastest].Result.CompileMs {
+				resp.Fastest = i
+			}
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// copyRecorded writes a recorded response to w
+func copyRecorded(w http.ResponseWriter, rec *httptest.ResponseRecorder) {
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+}
+
+// artifactSizes returns the size of every published file of job id and their total
+func (s *Server) artifactSizes(id string) (map[string]int64, int64) {
+	entries, err := os.ReadDir(filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, id))
+	if err != nil {
+		return nil, 0
+	}
+	sizes := make(map[string]int64, len(entries))
+	var total int64
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		sizes[e.Name()] = fi.Size()
+		total += fi.Size()
+	}
+	return sizes, total
+}
@@ -0,0 +1,143 @@
+//go:build linux
+
+package src
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultSeccompPolicy is the built-in kafel policy: everything the toolchain needs
+// stays allowed, while syscalls that only widen the kernel attack surface fail with EPERM
+const defaultSeccompPolicy = `POLICY emcc_sandboxd {
+  ERRNO(1) {
+    ptrace, process_vm_readv, process_vm_writev, kcmp,
+    mount, umount2, pivot_root, chroot, unshare, setns,
+    bpf, perf_event_open, userfaultfd, keyctl, add_key, request_key,
+    init_module, finit_module, delete_module, kexec_load, kexec_file_load,
+    reboot, swapon, swapoff, acct, quotactl, syslog, lookup_dcookie,
+    open_by_handle_at, name_to_handle_at, personality
+  }
+}
+USE emcc_sandboxd DEFAULT ALLOW`
+
+// nsjailCommand wraps argv in nsjail with jobDir bind mounted as the working directory.
+// Every job gets a network namespace of its own: empty without network, and with
+// only loopback, where the relay to the egress proxy listens, with it.
+func (s *Server) nsjailCommand(ctx context.Context, jobDir string, argv []string, network bool) (*exec.Cmd, error) {
+	netArgs := []string{"--iface_no_lo"}
+	if network {
+		// The job keeps a namespace of its own with only loopback, on which the relay
+		// forwards to the egress proxy; nothing else is reachable
+		self, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		sock, err := s.egressSocketPath()
+		if err != nil {
+			return nil, err
+		}
+		netArgs = []string{"--bindmount_ro", self, "--bindmount", sock + ":" + jailEgressSocket}
+		for _, kv := range s.proxyEnv() {
+			netArgs = append(netArgs, "--env", kv)
+		}
+		argv = append([]string{self, NetRelayArg, jailEgressSocket, s.cfg.NetworkProxyAddr, "--"}, argv...)
+	}
+	nsArgs := append(netArgs,
+		"--quiet",
+		"--cwd", "/work",
+		"--bindmount", fmt.Sprintf("%s:/work", jobDir),
+		"--rlimit_fsize", "256", // MiB
+		// V8 reserves large virtual ranges; memory is bounded by cgroups instead
+		"--rlimit_as", "max",
+		"--rlimit_nofile", "soft",
+		"--time_limit", strconv.Itoa(s.timeLimitSecs(ctx)),
+		// the kernel enforces this even if nsjail itself is killed
+		"--rlimit_cpu", strconv.Itoa(s.cpuLimitSecs(ctx)),
+		// nsjail mounts a fresh read-only /proc for the job's PID namespace
+		"--tmpfsmount", "/tmp",
+		"--bindmount", "/dev/null",
+		"--bindmount_ro", "/dev/urandom",
+	)
+	// System directories and the toolchain are visible read-only at their host paths
+	for _, dir := range append(append([]string{}, s.cfg.NsJailReadOnlyMounts...), s.toolchainDirs()...) {
+		if _, err := os.Stat(dir); err == nil {
+			nsArgs = append(nsArgs, "--bindmount_ro", dir)
+		}
+	}
+	if s.cfg.PCHDir != "" {
+		nsArgs = append(nsArgs, "--bindmount_ro", s.cfg.PCHDir)
+	}
+	// The job's cache stays writable on top of the read-only SDK
+	if cache := s.jobCacheDir(jobDir); cache != "" {
+		nsArgs = append(nsArgs, "--bindmount", cache, "--env", "EM_CACHE="+cache)
+	}
+	if s.cfg.CcacheDir != "" {
+		nsArgs = append(nsArgs, "--bindmount", s.cfg.CcacheDir)
+		for _, kv := range s.ccacheEnv("/work") {
+			nsArgs = append(nsArgs, "--env", kv)
+		}
+	}
+	if s.cfg.CompileUID >= 0 {
+		nsArgs = append(nsArgs, "--user", strconv.Itoa(s.cfg.CompileUID), "--group", strconv.Itoa(s.cfg.CompileGID))
+	}
+	for _, kv := range s.toolchainEnv() {
+		nsArgs = append(nsArgs, "--env", kv)
+	}
+	switch s.cfg.NsJailSeccompPolicy {
+	case "":
+	case "default":
+		nsArgs = append(nsArgs, "--seccomp_string", defaultSeccompPolicy)
+	default:
+		nsArgs = append(nsArgs, "--seccomp_policy", s.cfg.NsJailSeccompPolicy)
+	}
+	nsArgs = append(nsArgs, "--")
+	nsArgs = append(nsArgs, argv...)
+	return exec.CommandContext(ctx, s.cfg.NsJailPath, nsArgs...), nil
+}
+
+// toolchainDirs returns the host directories holding emsdk, node, python and ccache
+func (s *Server) toolchainDirs() []string {
+	var dirs []string
+	if s.cfg.EmsdkPath != "" {
+		dirs = append(dirs, s.cfg.EmsdkPath)
+	}
+	for _, bin := range []string{s.cfg.NodePath, s.cfg.PythonPath} {
+		if bin != "" {
+			dirs = append(dirs, filepath.Dir(bin))
+		}
+	}
+	// emcc runs ccache through EM_COMPILER_WRAPPER by its absolute path
+	if bin := s.ccacheBinary(); s.cfg.CcacheDir != "" && bin != "" {
+		dirs = append(dirs, filepath.Dir(bin))
+	}
+	return dirs
+}
+
+// toolchainEnv is the environment emcc runs with inside the jail, which starts empty
+func (s *Server) toolchainEnv() []string {
+	path := []string{"/usr/local/bin", "/usr/bin", "/bin"}
+	env := []string{"HOME=/tmp"}
+	if s.cfg.EmsdkPath != "" {
+		path = append([]string{s.cfg.EmsdkPath, filepath.Join(s.cfg.EmsdkPath, "upstream", "emscripten")}, path...)
+		env = append(env, "EMSDK="+s.cfg.EmsdkPath)
+		cfgFile := filepath.Join(s.cfg.EmsdkPath, ".emscripten")
+		if _, err := os.Stat(cfgFile); err == nil {
+			env = append(env, "EM_CONFIG="+cfgFile)
+		}
+	}
+	if s.cfg.NodePath != "" {
+		path = append([]string{filepath.Dir(s.cfg.NodePath)}, path...)
+		env = append(env, "EMSDK_NODE="+s.cfg.NodePath)
+	}
+	if s.cfg.PythonPath != "" {
+		path = append([]string{filepath.Dir(s.cfg.PythonPath)}, path...)
+		env = append(env, "EMSDK_PYTHON="+s.cfg.PythonPath)
+	}
+	return append(env, "PATH="+strings.Join(path, ":"))
+}
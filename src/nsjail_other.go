@@ -0,0 +1,15 @@
+//go:build !linux
+
+package src
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// nsjailCommand is unavailable outside Linux; nsjail relies on Linux namespaces
+func (s *Server) nsjailCommand(ctx context.Context, jobDir string, argv []string, network bool) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("nsjail is not available on %s", runtime.GOOS)
+}
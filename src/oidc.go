@@ -0,0 +1,317 @@
+package src
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksMaxAge is how long fetched issuer keys are trusted before they are fetched again
+	jwksMaxAge = time.Hour
+	// jwksMinRefresh bounds refetches triggered by tokens signed with unknown keys
+	jwksMinRefresh = time.Minute
+	// jwtLeeway tolerates clock skew between the issuer and this server
+	jwtLeeway = time.Minute
+)
+
+// jwtClaims are the claims of a verified token; Roles come from oidcRolesClaim
+type jwtClaims struct {
+	Subject string
+	Roles   []string
+}
+
+// oidcKeys caches the signing keys of oidcIssuer, by key ID
+type oidcKeys struct {
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	// closed once the fetch in progress, if any, finished
+	fetching chan struct{}
+}
+
+// oidcResultKey is the context key of the request's verified OIDC token
+type oidcResultKey struct{}
+
+// oidcResult is the outcome of verifying the OIDC token of a request
+type oidcResult struct {
+	claims jwtClaims
+	ok     bool
+}
+
+// jwk is one key of a JSON Web Key Set
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// withOIDC verifies the OIDC token a request bears once, for oidcClaims to look up
+// as often as authorization and logging need it
+func (s *Server) withOIDC(next http.Handler) http.Handler {
+	if s.cfg.OIDCIssuer == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := s.verifyRequestToken(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), oidcResultKey{}, oidcResult{claims: c, ok: ok})))
+	})
+}
+
+// oidcClaims returns the claims of the OIDC token r bears, if withOIDC found a
+// valid one; requests that did not pass through it, such as those to the artifact
+// listener, carry none
+func (s *Server) oidcClaims(r *http.Request) (jwtClaims, bool) {
+	res, _ := r.Context().Value(oidcResultKey{}).(oidcResult)
+	return res.claims, res.ok
+}
+
+// verifyRequestToken verifies the bearer token of r as an OIDC token
+func (s *Server) verifyRequestToken(r *http.Request) (jwtClaims, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || s.cfg.OIDCIssuer == "" || strings.Count(token, ".") != 2 {
+		return jwtClaims{}, false
+	}
+	c, err := s.verifyJWT(token)
+	if err != nil {
+		return jwtClaims{}, false
+	}
+	return c, true
+}
+
+// verifyJWT checks the signature, issuer, audience and lifetime of token
+func (s *Server) verifyJWT(token string) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return jwtClaims{}, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return jwtClaims{}, err
+	}
+	key, err := s.oidcKey(header.Kid)
+	if err != nil {
+		return jwtClaims{}, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return jwtClaims{}, fmt.Errorf("unsupported alg %q for an RSA key", header.Alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return jwtClaims{}, err
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 {
+			return jwtClaims{}, fmt.Errorf("unsupported alg %q for an EC key", header.Alg)
+		}
+		r, sv := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, digest[:], r, sv) {
+			return jwtClaims{}, errors.New("invalid signature")
+		}
+	default:
+		return jwtClaims{}, errors.New("unsupported key type")
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return jwtClaims{}, err
+	}
+	now := time.Now()
+	if iss, _ := claims["iss"].(string); iss != s.cfg.OIDCIssuer {
+		return jwtClaims{}, fmt.Errorf("issuer %q", iss)
+	}
+	if s.cfg.OIDCAudience != "" && !slices.Contains(claimStrings(claims["aud"]), s.cfg.OIDCAudience) {
+		return jwtClaims{}, errors.New("audience mismatch")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return jwtClaims{}, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return jwtClaims{}, errors.New("token not yet valid")
+	}
+	sub, _ := claims["sub"].(string)
+	return jwtClaims{Subject: sub, Roles: claimStrings(lookupClaim(claims, s.cfg.OIDCRolesClaim))}, nil
+}
+
+// decodeJWTPart decodes a base64url JSON part of a token into v
+func decodeJWTPart(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// lookupClaim returns the claim at a dotted path, e.g. realm_access.roles
+func lookupClaim(claims map[string]any, path string) any {
+	var v any = claims
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// claimStrings returns a claim holding a string or a list of strings as a list
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var out []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// oidcKey returns the issuer key kid, fetching the key set when it is stale or
+// lacks kid, as happens right after the issuer rotated its keys. The key set is
+// fetched outside the lock, once for all requests needing it.
+func (s *Server) oidcKey(kid string) (crypto.PublicKey, error) {
+	for {
+		s.oidc.mu.Lock()
+		key, ok := s.oidc.keys[kid]
+		age := time.Since(s.oidc.fetched)
+		if (ok && age < jwksMaxAge) || (!ok && age < jwksMinRefresh) {
+			s.oidc.mu.Unlock()
+			if !ok {
+				return nil, fmt.Errorf("unknown key %q", kid)
+			}
+			return key, nil
+		}
+		if wait := s.oidc.fetching; wait != nil {
+			s.oidc.mu.Unlock()
+			if ok {
+				// a stale key serves until the refresh is done
+				return key, nil
+			}
+			<-wait
+			continue
+		}
+		done := make(chan struct{})
+		s.oidc.fetching = done
+		s.oidc.mu.Unlock()
+
+		keys, err := fetchJWKS(s.cfg.OIDCIssuer)
+		s.oidc.mu.Lock()
+		s.oidc.fetched = time.Now()
+		// keep serving the keys we have while the issuer is unreachable
+		if err == nil {
+			s.oidc.keys = keys
+		}
+		s.oidc.fetching = nil
+		s.oidc.mu.Unlock()
+		close(done)
+		if err != nil && !ok {
+			return nil, err
+		}
+	}
+}
+
+// fetchJWKS discovers the key set of issuer and returns its signing keys
+func fetchJWKS(issuer string) (map[string]crypto.PublicKey, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("issuer announces no jwks_uri")
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(discovery.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// getJSON fetches url and decodes its JSON body into v
+func getJSON(url string, v any) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// publicKey converts an RSA or P-256 key of a key set
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// ecdsa.Verify rejects points off the curve
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
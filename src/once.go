@@ -0,0 +1,19 @@
+package src
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+// CompileOnce runs a single compile of the JSON compile request in body through the
+// same pipeline as POST /compile, without starting the HTTP server, and writes the
+// response to out. It reports whether the build succeeded.
+func (s *Server) CompileOnce(ctx context.Context, body io.Reader, out io.Writer) bool {
+	r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/v"+apiVersion+"/compile", body)
+	rec := httptest.NewRecorder()
+	s.HandleCompile(rec, r)
+	_, _ = out.Write(rec.Body.Bytes())
+	return rec.Code == http.StatusOK
+}
@@ -0,0 +1,169 @@
+package src
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Output modes selectable via CompileRequest.Output
+const (
+	outputWasm      = "wasm"
+	outputObject    = "object"
+	outputStaticLib = "staticlib"
+	// emscripten's shell page next to app.js/app.wasm, only when allowHTMLOutput is set
+	outputHTML = "html"
+	// text outputs for inspecting the toolchain, no wasm is produced
+	outputPreprocessed = "preprocessed"
+	outputAsm          = "asm"
+	outputLLVMIR       = "llvm-ir"
+)
+
+// outputPlan describes how a job produces its artifacts
+type outputPlan struct {
+	args  []string   // flags appended to the compiler invocation
+	post  [][]string // commands run in the job dir after the compiler succeeds
+	files []string   // primary outputs of the mode
+	// files produced along the way that are not published
+	intermediates []string
+}
+
+// normalizeOutput validates the requested output mode, defaulting to wasm
+func normalizeOutput(mode string) (string, bool) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return outputWasm, true
+	case outputWasm, outputHTML, outputObject, outputStaticLib, outputPreprocessed, outputAsm, outputLLVMIR:
+		return mode, true
+	}
+	return "", false
+}
+
+// planOutput returns the plan for mode given the filtered compiler args; outputs are named base.<ext>
+func planOutput(mode string, args []string, base string) outputPlan {
+	switch mode {
+	case outputObject:
+		return outputPlan{
+			args:  []string{"-c", "-o", base + ".o"},
+			files: []string{base + ".o"},
+		}
+	case outputStaticLib:
+		return outputPlan{
+			args:          []string{"-c", "-o", base + ".o"},
+			post:          [][]string{{"emar", "rcs", base + ".a", base + ".o"}},
+			files:         []string{base + ".a"},
+			intermediates: []string{base + ".o"},
+		}
+	case outputPreprocessed:
+		return outputPlan{
+			args:  []string{"-E", "-o", base + ".i"},
+			files: []string{base + ".i"},
+		}
+	case outputAsm:
+		return outputPlan{
+			args:  []string{"-S", "-o", base + ".s"},
+			files: []string{base + ".s"},
+		}
+	case outputLLVMIR:
+		return outputPlan{
+			args:  []string{"-S", "-emit-llvm", "-o", base + ".ll"},
+			files: []string{base + ".ll"},
+		}
+	case outputHTML:
+		return outputPlan{
+			args:  []string{"-o", base + ".html"},
+			files: []string{base + ".html", base + ".js", base + ".wasm"},
+		}
+	}
+	// Side modules have no JS loader
+	if isSideModule(args) {
+		return outputPlan{
+			args:  []string{"-o", base + ".wasm"},
+			files: []string{base + ".wasm"},
+		}
+	}
+	// Emscripten will place .wasm next to .js
+	return outputPlan{
+		args:  []string{"-o", base + ".js"},
+		files: []string{base + ".js", base + ".wasm"},
+	}
+}
+
+// discoverOutputs lists the files a build left in jobDir, excluding the submitted
+// source, intermediates and any names in exclude. Flags such as -pthread,
+// --preload-file, -gsource-map or an .html shell produce extra files next to the
+// main outputs.
+func discoverOutputs(jobDir, srcName string, plan outputPlan, exclude []string) ([]string, error) {
+	entries, err := os.ReadDir(jobDir)
+	if err != nil {
+		return nil, err
+	}
+	skip := map[string]bool{srcName: true}
+	for _, name := range append(plan.intermediates, exclude...) {
+		skip[name] = true
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || skip[e.Name()] {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
+
+// wantsWasmBody reports whether a compile request asked for the module itself as
+// the response, by ?download=wasm or an Accept of application/wasm without
+// application/json
+func wantsWasmBody(r *http.Request) bool {
+	if r.URL.Query().Get("download") == "wasm" {
+		return true
+	}
+	// clients also accepting JSON keep getting it
+	wasm := false
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			switch mediaType {
+			case "application/wasm":
+				wasm = true
+			case "application/json":
+				return false
+			}
+		}
+	}
+	return wasm
+}
+
+// serveWasmBody answers a successful compile with its published module. The
+// artifacts stay available too: the module's URL is sent as Content-Location and
+// the JS glue's as a related Link.
+func serveWasmBody(w http.ResponseWriter, r *http.Request, artDir string, resp CompileResponse, base string) {
+	f, err := os.Open(filepath.Join(artDir, base+".wasm"))
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/wasm")
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", base+".wasm"))
+	h.Set("Content-Location", resp.WASM)
+	h.Set("X-Job-Id", resp.ID)
+	if resp.JS != "" {
+		h.Add("Link", "<"+resp.JS+">; rel=\"related\"")
+	}
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
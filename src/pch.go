@@ -0,0 +1,131 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// pchHeaderName is the header in pchDir that includes every configured header
+const pchHeaderName = "std.hpp"
+
+// pchVariants are the optimization levels a precompiled header is built for; clang
+// refuses a PCH whose __OPTIMIZE__ or __OPTIMIZE_SIZE__ differ from the compile's.
+// Every level that defines the same macros shares a variant.
+var pchVariants = map[string]string{"": "O0", "-O0": "O0", "-O1": "O2", "-O2": "O2", "-O3": "O2", "-Os": "Os", "-Oz": "Oz"}
+
+// pchHeaderPattern restricts configured headers to plain include names
+var pchHeaderPattern = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*(\.[A-Za-z0-9]+)?$`)
+
+// includePattern matches the system includes of a source
+var includePattern = regexp.MustCompile(`(?m)^\s*#\s*include\s*<([^>]+)>`)
+
+// pchPath returns where the precompiled header of variant is kept
+func (s *Server) pchPath(variant string) string {
+	return filepath.Join(s.cfg.PCHDir, "std-"+variant+".pch")
+}
+
+// warmPCH builds the precompiled header of every variant from pchHeaders. It runs
+// in the background at startup; jobs use a variant once it is ready.
+func (s *Server) warmPCH(ctx context.Context) {
+	if s.cfg.PCHDir == "" || len(s.cfg.PCHHeaders) == 0 {
+		return
+	}
+	var b strings.Builder
+	for _, h := range s.cfg.PCHHeaders {
+		fmt.Fprintf(&b, "#include <%s>\n", h)
+	}
+	header := filepath.Join(s.cfg.PCHDir, pchHeaderName)
+	// clang checks the PCH against the header's mtime, so leave an unchanged header alone
+	if old, err := os.ReadFile(header); err != nil || string(old) != b.String() {
+		if err := writeFileAtomic(header, []byte(b.String()), 0o644); err != nil {
+			log.Printf("pch: %v", err)
+			return
+		}
+	}
+	built := map[string]bool{}
+	for flag, variant := range pchVariants {
+		if built[variant] {
+			continue
+		}
+		built[variant] = true
+		start := time.Now()
+		if err := s.buildPCH(ctx, flag, variant); err != nil {
+			s.alert("pch-error", "building precompiled header %s: %v", variant, err)
+			continue
+		}
+		s.pchMu.Lock()
+		s.pchReady[variant] = true
+		s.pchMu.Unlock()
+		log.Printf("pch: built %s in %s", variant, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// buildPCH compiles the header of pchDir with the default args and opt, publishing it
+// only once complete
+func (s *Server) buildPCH(ctx context.Context, opt, variant string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.compileTimeout())
+	defer cancel()
+	out := s.pchPath(variant)
+	tmp := out + ".tmp"
+	argv := append(strings.Fields(s.cfg.CompilerCpp), "-x", "c++-header", pchHeaderName, "-o", tmp)
+	argv = append(append(argv, s.cfg.DefaultArgs...), opt)
+	cmd := exec.CommandContext(ctx, compilerBinary(argv[0]), argv[1:]...)
+	cmd.Dir = s.cfg.PCHDir
+	if b, err := cmd.CombinedOutput(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(b)))
+	}
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+// pchArgs returns the flags making a C++ compile with args use a precompiled header,
+// or nil when none fits: the source includes none of the headers, or args change
+// language options the header was built without
+func (s *Server) pchArgs(lang, mode, code string, args []string) []string {
+	if s.cfg.PCHDir == "" || lang == "c" || mode == outputPreprocessed || !includesAny(code, s.cfg.PCHHeaders) {
+		return nil
+	}
+	opt := ""
+	for _, a := range args {
+		switch {
+		case strings.HasPrefix(a, "-O"):
+			opt = a
+		case strings.HasPrefix(a, "-m"), strings.HasPrefix(a, "-sSIDE_MODULE="), strings.HasPrefix(a, "-sMAIN_MODULE="):
+			// target features and PIC are part of the PCH
+			return nil
+		}
+	}
+	variant, ok := pchVariants[opt]
+	if !ok {
+		return nil
+	}
+	s.pchMu.Lock()
+	ready := s.pchReady[variant]
+	s.pchMu.Unlock()
+	if !ready {
+		return nil
+	}
+	return []string{"-include-pch", s.pchPath(variant)}
+}
+
+// includesAny reports whether code includes one of headers as a system header
+func includesAny(code string, headers []string) bool {
+	for _, m := range includePattern.FindAllStringSubmatch(code, -1) {
+		for _, h := range headers {
+			if strings.TrimSpace(m[1]) == h {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package src
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// portSettings maps the -s settings that pull in emscripten ports to the ports
+// they need, dependencies included, by the name emcc caches them under
+var portSettings = map[string][]string{
+	"USE_ZLIB":          {"zlib"},
+	"USE_BZIP2":         {"bzip2"},
+	"USE_LIBPNG":        {"libpng", "zlib"},
+	"USE_LIBJPEG":       {"libjpeg"},
+	"USE_GIFLIB":        {"giflib"},
+	"USE_FREETYPE":      {"freetype"},
+	"USE_HARFBUZZ":      {"harfbuzz", "freetype"},
+	"USE_OGG":           {"ogg"},
+	"USE_VORBIS":        {"vorbis", "ogg"},
+	"USE_MPG123":        {"mpg123"},
+	"USE_MODPLUG":       {"libmodplug"},
+	"USE_BULLET":        {"bullet"},
+	"USE_BOOST_HEADERS": {"boost_headers"},
+	"USE_ICU":           {"icu"},
+	"USE_SQLITE3":       {"sqlite3"},
+	"USE_COCOS2D":       {"cocos2d"},
+}
+
+// sdlPortSettings are the SDL settings, which only need a port at version 2; SDL 1
+// is built into emscripten's JS library
+var sdlPortSettings = map[string][]string{
+	"USE_SDL":       {"sdl2"},
+	"USE_SDL_IMAGE": {"sdl2_image", "sdl2"},
+	"USE_SDL_TTF":   {"sdl2_ttf", "sdl2", "freetype", "harfbuzz"},
+	"USE_SDL_MIXER": {"sdl2_mixer", "sdl2"},
+	"USE_SDL_NET":   {"sdl2_net", "sdl2"},
+	"USE_SDL_GFX":   {"sdl2_gfx", "sdl2"},
+}
+
+// portOptionsPattern matches the options of --use-port=<name>:<options>, e.g.
+// formats=png,jpg, which must not name files
+var portOptionsPattern = regexp.MustCompile(`^[A-Za-z0-9_=,:-]+$`)
+
+// checkPortArg reports whether a is a -sUSE_* setting or --use-port flag that
+// pulls in a port, and if so whether it names a known port with a valid value:
+// 0 or 1, or also 2 for the SDL settings. Local ports given as .py files are not
+// known.
+func checkPortArg(a string) (isPort, valid bool) {
+	if spec, ok := strings.CutPrefix(a, "--use-port="); ok {
+		name, options, hasOptions := strings.Cut(spec, ":")
+		if hasOptions && !portOptionsPattern.MatchString(options) {
+			return true, false
+		}
+		return true, knownPort(name)
+	}
+	setting, ok := strings.CutPrefix(a, "-s")
+	if !ok {
+		return false, false
+	}
+	name, value, hasValue := strings.Cut(setting, "=")
+	if !hasValue {
+		value = "1"
+	}
+	if _, ok := portSettings[name]; ok {
+		return true, value == "0" || value == "1"
+	}
+	if _, ok := sdlPortSettings[name]; ok {
+		return true, value == "0" || value == "1" || value == "2"
+	}
+	return false, false
+}
+
+// knownPort reports whether name is one of the ports the settings tables pull in
+func knownPort(name string) bool {
+	for _, table := range []map[string][]string{portSettings, sdlPortSettings} {
+		for _, deps := range table {
+			if slices.Contains(deps, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// neededPorts returns the ports args build with, from -sUSE_* settings and
+// --use-port; later flags override earlier ones, as in emcc
+func neededPorts(args []string) []string {
+	settings := make(map[string]string)
+	var ports []string
+	for _, a := range args {
+		if name, ok := strings.CutPrefix(a, "--use-port="); ok {
+			name, _, _ = strings.Cut(name, ":")
+			// a port given as a .py file is local and never downloaded
+			if !strings.HasSuffix(name, ".py") {
+				ports = append(ports, name)
+			}
+			continue
+		}
+		setting, ok := strings.CutPrefix(a, "-s")
+		if !ok {
+			continue
+		}
+		name, value, hasValue := strings.Cut(setting, "=")
+		if !hasValue {
+			value = "1"
+		}
+		settings[name] = value
+	}
+	for name, value := range settings {
+		if deps, ok := portSettings[name]; ok && value != "0" {
+			ports = append(ports, deps...)
+		}
+		if deps, ok := sdlPortSettings[name]; ok && value == "2" {
+			ports = append(ports, deps...)
+		}
+	}
+	slices.Sort(ports)
+	return slices.Compact(ports)
+}
+
+// missingPorts returns the ports args need that the shared Emscripten cache does
+// not hold yet, which emcc would download on first use. Without a known cache it
+// cannot tell and returns none.
+func (s *Server) missingPorts(args []string) []string {
+	cache := s.emCacheDir()
+	if cache == "" {
+		return nil
+	}
+	var missing []string
+	for _, name := range neededPorts(args) {
+		if _, err := os.Stat(filepath.Join(cache, "ports", name)); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,124 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// previewIDPattern matches the IDs newPreview gives previews; they are long enough
+// not to be guessed, as anyone holding one sees the page
+var previewIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// preview is a live preview route, pointing at the latest html build sent to it
+type preview struct {
+	jobID string
+}
+
+// previewReloadScript polls the preview's version and reloads the page once a newer
+// build replaced the one it shows
+const previewReloadScript = `<script>(function(){var v=%q;setInterval(function(){` +
+	`fetch("_version",{cache:"no-store"}).then(function(r){return r.json()}).then(function(d){if(d.id!==v)location.reload()}).catch(function(){})` +
+	`},1000)})();</script>`
+
+// setPreview points preview id at the artifacts of job jobID, creating it if id is
+// empty or unknown; it returns the preview's ID
+func (s *Server) setPreview(id, jobID string) (string, error) {
+	s.previewMu.Lock()
+	defer s.previewMu.Unlock()
+	if _, ok := s.previews[id]; !ok {
+		var err error
+		if id, err = randomID(8); err != nil {
+			return "", err
+		}
+	}
+	s.previews[id] = &preview{jobID: jobID}
+	return id, nil
+}
+
+// previewJob returns the job a preview currently shows
+func (s *Server) previewJob(id string) (string, bool) {
+	s.previewMu.Lock()
+	defer s.previewMu.Unlock()
+	p, ok := s.previews[id]
+	if !ok {
+		return "", false
+	}
+	return p.jobID, true
+}
+
+// previewURL returns the URL of the page of preview id, next to the artifacts
+func (s *Server) previewURL(r *http.Request, id string) string {
+	p := "/preview/" + id + "/" + s.cfg.OutputName + ".html"
+	if s.cfg.ArtifactsBaseURL != "" || s.cfg.ArtifactsAddr != "" {
+		return strings.TrimSuffix(s.cfg.ArtifactsBaseURL, "/") + p
+	}
+	return s.publicURL(r, p)
+}
+
+// handlePreview serves GET /preview/{id}/{file}: the files of the build a preview
+// currently shows, its page with auto-reload injected, and _version, the ID of that
+// build, which the page polls
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w)
+		return
+	}
+	id, file := r.PathValue("id"), r.PathValue("file")
+	jobID, ok := s.previewJob(id)
+	if !previewIDPattern.MatchString(id) || !ok || !s.artifactExists(jobID) {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no preview "+id)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if file == "_version" {
+		// the sandboxed page has an opaque origin, so its polls are cross-origin
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": jobID})
+		return
+	}
+	path := filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, jobID, filepath.Base(file))
+	if file != s.cfg.OutputName+".html" {
+		s.withArtifactHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, path)
+		})).ServeHTTP(w, r)
+		return
+	}
+	page, err := os.ReadFile(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no preview "+id)
+		return
+	}
+	script := fmt.Sprintf(previewReloadScript, jobID)
+	if i := bytes.LastIndex(page, []byte("</body>")); i >= 0 {
+		page = append(page[:i:i], append([]byte(script), page[i:]...)...)
+	} else {
+		page = append(page, script...)
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("X-Content-Type-Options", "nosniff")
+	if s.cfg.HTMLContentSecurityPolicy != "" {
+		h.Set("Content-Security-Policy", s.cfg.HTMLContentSecurityPolicy)
+	}
+	// a preview exists to be looked at, whatever htmlDisposition says
+	h.Set("Content-Disposition", "inline")
+	_, _ = w.Write(page)
+}
+
+// prunePreviews forgets previews whose build has been cleaned up
+func (s *Server) prunePreviews() {
+	s.previewMu.Lock()
+	defer s.previewMu.Unlock()
+	for id, p := range s.previews {
+		if !s.artifactExists(p.jobID) {
+			delete(s.previews, id)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package src
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+// ioprio_set(2) constants
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	// lowest level within the best-effort class
+	ioprioLowestLevel = 7
+)
+
+// ioClasses maps compileIOClass values to I/O scheduling classes
+var ioClasses = map[string]int{"best-effort": 2, "idle": 3}
+
+// PriorityExec is the body of the priority-exec helper, called with
+// <nice> <ioClass> -- <path> <argv...>: it lowers its own priority, then replaces
+// itself with argv. It only returns on failure.
+func PriorityExec(args []string) int {
+	if len(args) < 5 || args[2] != "--" {
+		fmt.Fprintln(os.Stderr, "priority-exec: usage: <nice> <ioClass> -- <path> <argv...>")
+		return 126
+	}
+	nice, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "priority-exec: bad nice value: %v\n", err)
+		return 126
+	}
+	// both priorities are per thread here; exec carries the calling thread's over
+	runtime.LockOSThread()
+	if err := setProcessPriority(0, nice, args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "priority-exec: %v\n", err)
+		return 126
+	}
+	err = syscall.Exec(args[3], args[4:], os.Environ())
+	fmt.Fprintf(os.Stderr, "priority-exec: %v\n", err)
+	return 126
+}
+
+// setProcessPriority lowers the CPU and I/O priority of process pid, 0 being the
+// calling thread; processes it starts afterwards inherit both
+func setProcessPriority(pid, nice int, ioClass string) error {
+	if nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice); err != nil {
+			return err
+		}
+	}
+	if class, ok := ioClasses[ioClass]; ok {
+		prio := class<<ioprioClassShift | ioprioLowestLevel
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(prio)); errno != 0 {
+			return errno
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package src
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// PriorityExec is unavailable outside Linux
+func PriorityExec(args []string) int {
+	fmt.Fprintf(os.Stderr, "priority-exec: not available on %s\n", runtime.GOOS)
+	return 126
+}
+
+// setProcessPriority is unavailable outside Linux; ValidatePlatform rejects
+// compileNice and compileIOClass there
+func setProcessPriority(pid, nice int, ioClass string) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build !unix && !windows
+
+package src
+
+import "os/exec"
+
+// configureProcess leaves the default kill-on-cancel behavior in place
+func configureProcess(cmd *exec.Cmd) {}
+
+// reapProcessGroup is a no-op on this platform
+func reapProcessGroup(cmd *exec.Cmd) {}
+
+// compilerBinary returns the executable name of a toolchain command
+func compilerBinary(name string) string {
+	return name
+}
+
+// setCredential is not supported on this platform
+func setCredential(cmd *exec.Cmd, uid, gid int) {}
+
+// syncDir is a no-op on this platform
+func syncDir(dir string) error { return nil }
+
+// crossDevice cannot tell why a rename failed here, so any failure is retried as a copy
+func crossDevice(err error) bool { return true }
@@ -0,0 +1,53 @@
+//go:build unix
+
+package src
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// configureProcess runs the compiler in its own process group so cancellation
+// also reaches the node/python processes emcc spawns
+func configureProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// reapProcessGroup kills whatever is left of cmd's process group once cmd has
+// exited, such as a node process emcc started but did not wait for
+func reapProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil && cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// compilerBinary returns the executable name of a toolchain command
+func compilerBinary(name string) string {
+	return name
+}
+
+// setCredential makes the compiler run as uid/gid, dropping supplementary groups
+func setCredential(cmd *exec.Cmd, uid, gid int) {
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: []uint32{}}
+}
+
+// syncDir flushes the entries of dir, so renames into it survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// crossDevice reports whether a rename failed because source and target are on
+// different filesystems
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
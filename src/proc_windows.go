@@ -0,0 +1,47 @@
+//go:build windows
+
+package src
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// configureProcess detaches the compiler into its own process group and kills
+// the whole tree on cancellation, since emcc.bat runs python via cmd.exe
+func configureProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+	cmd.Cancel = func() error {
+		return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	}
+}
+
+// reapProcessGroup is a no-op; taskkill cannot find the tree of an exited process
+func reapProcessGroup(cmd *exec.Cmd) {}
+
+// compilerBinary returns the executable name of a toolchain command; emsdk
+// ships its drivers as batch wrappers on Windows
+func compilerBinary(name string) string {
+	switch name {
+	case "emcc", "em++", "emar", "emranlib":
+		return name + ".bat"
+	}
+	return name
+}
+
+// setCredential is not supported on Windows; ValidatePlatform rejects compileUID there
+func setCredential(cmd *exec.Cmd, uid, gid int) {}
+
+// syncDir is a no-op; Windows cannot flush a directory handle
+func syncDir(dir string) error { return nil }
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned by renames across volumes
+const errorNotSameDevice = syscall.Errno(17)
+
+// crossDevice reports whether a rename failed because source and target are on
+// different volumes
+func crossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,62 @@
+package src
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// profileNamePattern restricts target profile names
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// defaultTargetProfiles describe common runtimes by the emcc settings that target
+// them and the wasm features they support
+func defaultTargetProfiles() map[string]TargetProfile {
+	baseline := []string{"sign-ext", "mutable-globals", "bulk-memory", "nontrapping-fptoint", "multivalue", "reference-types"}
+	modern := append([]string{"simd128", "atomics"}, baseline...)
+	return map[string]TargetProfile{
+		"chrome100":  {Args: []string{"-sMIN_CHROME_VERSION=100"}, Features: modern},
+		"firefox100": {Args: []string{"-sMIN_FIREFOX_VERSION=100"}, Features: modern},
+		"safari15":   {Args: []string{"-sMIN_SAFARI_VERSION=150000"}, Features: baseline},
+		// wasm SIMD only arrived in Safari 16.4
+		"safari16":      {Args: []string{"-sMIN_SAFARI_VERSION=160000"}, Features: append([]string{"atomics"}, baseline...)},
+		"node18":        {Args: []string{"-sMIN_NODE_VERSION=180000", "-sENVIRONMENT=node"}, Features: modern},
+		"wasi-preview1": {Args: []string{"-sSTANDALONE_WASM=1"}, Features: []string{"sign-ext", "mutable-globals", "bulk-memory", "nontrapping-fptoint", "simd128"}},
+	}
+}
+
+// profileAllowed reports whether p may be used; profiles targeting node, such as
+// node18, are hidden unless allowNodeEnvironment is set, as their args are not filtered
+func (s *Server) profileAllowed(p TargetProfile) bool {
+	return s.cfg.AllowNodeEnvironment || !slices.ContainsFunc(p.Args, targetsNode)
+}
+
+// resolveProfile looks up the target profile a request names and checks the
+// feature flags among the request's args against it
+func (s *Server) resolveProfile(name string, args []string) (*ResolvedProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := s.cfg.TargetProfiles[name]
+	if !ok || !s.profileAllowed(p) {
+		names := make([]string, 0, len(s.cfg.TargetProfiles))
+		for n, p := range s.cfg.TargetProfiles {
+			if s.profileAllowed(p) {
+				names = append(names, n)
+			}
+		}
+		sort.Strings(names)
+		return nil, fieldErrorf("profile", "unknown profile %q; known: %s", name, strings.Join(names, ", "))
+	}
+	for _, a := range args {
+		feature, ok := strings.CutPrefix(strings.TrimSpace(a), "-m")
+		if !ok || strings.HasPrefix(feature, "no-") {
+			continue
+		}
+		if !slices.Contains(p.Features, feature) {
+			return nil, fieldErrorf("args", "%s: profile %s does not support %s", a, name, feature)
+		}
+	}
+	return &ResolvedProfile{Name: name, Args: p.Args, Features: p.Features}, nil
+}
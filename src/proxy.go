@@ -0,0 +1,131 @@
+package src
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies parses trustedProxies, addresses or CIDR ranges of the
+// reverse proxies whose forwarding headers are believed
+func parseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, e := range entries {
+		if p, err := netip.ParsePrefix(e); err == nil {
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", e)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trusted reports whether addr is one of the trusted proxies
+func (s *Server) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range s.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerAddr returns the address r came from directly
+func peerAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr, err == nil
+}
+
+// fromTrustedProxy reports whether r was forwarded by a trusted proxy, so its
+// X-Forwarded-* headers can be believed
+func (s *Server) fromTrustedProxy(r *http.Request) bool {
+	addr, ok := peerAddr(r)
+	return ok && s.trusted(addr)
+}
+
+// clientIP returns the address of the client behind any trusted proxies. The
+// X-Forwarded-For chain is walked from the right, as every hop appends to it and
+// only entries added by trusted proxies are reliable.
+func (s *Server) clientIP(r *http.Request) string {
+	addr, ok := peerAddr(r)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !s.trusted(addr) {
+		return addr.String()
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop
+		if !s.trusted(hop) {
+			return hop.String()
+		}
+	}
+	if len(hops) == 0 {
+		if real, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return real.String()
+		}
+	}
+	return addr.String()
+}
+
+// requestOrigin returns scheme://host as the client addressed the server, taking
+// X-Forwarded-Proto and X-Forwarded-Host from trusted proxies
+func (s *Server) requestOrigin(r *http.Request) string {
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if s.fromTrustedProxy(r) {
+		if p := strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0])); p == "http" || p == "https" {
+			scheme = p
+		}
+		if h := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0]); h != "" {
+			host = h
+		}
+	}
+	return scheme + "://" + host
+}
+
+// publicURL returns the URL clients reach path p of the API listener at: under
+// basePath, and absolute when absoluteURLs is set
+func (s *Server) publicURL(r *http.Request, p string) string {
+	u := s.cfg.BasePath + p
+	if s.cfg.AbsoluteURLs {
+		u = s.requestOrigin(r) + u
+	}
+	return u
+}
+
+// withBasePath mounts next under basePath; requests outside it are not found
+func (s *Server) withBasePath(next http.Handler) http.Handler {
+	if s.cfg.BasePath == "" {
+		return next
+	}
+	stripped := http.StripPrefix(s.cfg.BasePath, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, s.cfg.BasePath+"/") {
+			writeError(w, http.StatusNotFound, codeNotFound, "", "not found")
+			return
+		}
+		stripped.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,152 @@
+package src
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// publishArtifacts moves outputs from jobDir to artDir as one step: they are
+// collected and synced in a hidden temporary directory that is then renamed into
+// place, so artDir either holds every output or does not exist. It fails if any
+// of the expected files is missing.
+func (s *Server) publishArtifacts(jobDir, artDir string, outputs, expected []string) error {
+	for _, name := range expected {
+		if !slices.Contains(outputs, name) {
+			return fmt.Errorf("build produced no %s", name)
+		}
+	}
+	parent := filepath.Dir(artDir)
+	tmp := filepath.Join(parent, "."+filepath.Base(artDir)+".tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		return err
+	}
+	if err := s.fillArtifactDir(jobDir, tmp, outputs); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, artDir); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	return syncDir(parent)
+}
+
+// fillArtifactDir moves outputs from jobDir into dir, gives them the configured
+// owner and permissions and syncs them to disk
+func (s *Server) fillArtifactDir(jobDir, dir string, outputs []string) error {
+	fileMode, _ := parseMode(s.cfg.ArtifactFileMode)
+	dirMode, _ := parseMode(s.cfg.ArtifactDirMode)
+	for _, name := range outputs {
+		dst := filepath.Join(dir, name)
+		if err := moveFile(filepath.Join(jobDir, name), dst); err != nil {
+			return fmt.Errorf("publishing %s: %w", name, err)
+		}
+		// sync while the file is still writable, as a read-only artifactFileMode
+		// would keep a non-root daemon from opening it for writing
+		if err := syncFile(dst); err != nil {
+			return fmt.Errorf("publishing %s: %w", name, err)
+		}
+		if err := s.setArtifactPerms(dst, fileMode); err != nil {
+			return fmt.Errorf("publishing %s: %w", name, err)
+		}
+	}
+	if err := s.setArtifactPerms(dir, dirMode); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// setArtifactPerms applies artifactUID/artifactGID and mode to path. Outputs would
+// otherwise keep the compile user as owner, which a separate web server may not read.
+func (s *Server) setArtifactPerms(path string, mode os.FileMode) error {
+	if s.cfg.ArtifactUID >= 0 || s.cfg.ArtifactGID >= 0 {
+		if err := os.Chown(path, s.cfg.ArtifactUID, s.cfg.ArtifactGID); err != nil {
+			return err
+		}
+	}
+	return os.Chmod(path, mode)
+}
+
+// writeFileAtomic replaces path with data through a temporary file of its own in
+// the same directory, synced to disk before the rename, so concurrent writers and
+// crashes leave either the old or the new contents
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncFile flushes the contents of path to disk
+func syncFile(path string) error {
+	// Windows only flushes handles opened for writing
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// moveFile renames src to dst. Across filesystems, as with a tmpfs jobsDir or
+// overlay job dirs, it copies instead and only removes src once the copy is on disk.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !crossDevice(err) {
+		return err
+	}
+	if err := copySynced(src, dst); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copySynced copies src to dst with src's permissions and fsyncs the copy
+func copySynced(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -2,14 +2,16 @@ package src
 
 import (
 	"context"
-	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
+	"log"
+	"slices"
 	// "sync"
 	"time"
 )
 
+// memRecheckInterval bounds how long a waiting job goes without re-checking the
+// budget; memory.current can fall without any event to watch for
+const memRecheckInterval = time.Second
+
 // ensureMemBudget initializes memBudgetBytes by reading cgroup v2 memory.max if available.
 func (s *Server) ensureMemBudget() error {
 	s.mu.Lock()
@@ -30,93 +32,124 @@ func (s *Server) ensureMemBudget() error {
 	return nil
 }
 
-// acquireMemory attempts to acquire memory for a job with the given estimate
+// acquireMemory attempts to acquire memory for a job with the given estimate.
+// Waiting jobs queue in arrival order and only the first re-checks the budget on
+// a wakeup, so a freed reservation does not send every waiter to read the cgroup.
 func (s *Server) acquireMemory(ctx context.Context, estimateBytes int64) error {
-	ticker := time.NewTicker(200 * time.Millisecond)
-	defer ticker.Stop()
-	for {
-		// fast path: try lock + check
-		s.mu.Lock()
-		max := s.memBudgetBytes
-		s.mu.Unlock()
-
-		if max == 0 { // unlimited or not configured
-			s.mu.Lock()
-			s.memReservedBytes += estimateBytes
-			s.mu.Unlock()
-			return nil
-		}
-
-		cur, err := readCgroupMemoryCurrent(s.cfg.CgroupV2Root)
-		if err != nil {
-			// if cannot read, be safe and wait a bit
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-ticker.C:
-				continue
-			}
-		}
-
-		// Attempt reservation atomically
-		s.mu.Lock()
-		if cur+s.memReservedBytes+estimateBytes <= max {
-			s.memReservedBytes += estimateBytes
-			s.mu.Unlock()
-			return nil
-		}
+	s.memWatchOnce.Do(s.startMemoryWatcher)
+	wake := make(chan struct{}, 1)
+	s.mu.Lock()
+	if s.memBudgetBytes == 0 { // unlimited or not configured
+		s.memReservedBytes += estimateBytes
 		s.mu.Unlock()
+		return nil
+	}
+	s.memWaiters = append(s.memWaiters, wake)
+	if len(s.memWaiters) == 1 {
+		// nobody ahead: check right away
+		wake <- struct{}{}
+	}
+	s.mu.Unlock()
 
+	for {
 		select {
 		case <-ctx.Done():
+			s.leaveMemoryQueue(wake)
 			return ctx.Err()
-		case <-ticker.C:
+		case <-wake:
+		}
+		if s.tryReserveMemory(estimateBytes) {
+			// the next job may fit in what is left
+			s.leaveMemoryQueue(wake)
+			return nil
 		}
 	}
 }
 
-// releaseMemory releases the memory reservation for a job
-func (s *Server) releaseMemory(estimateBytes int64) {
+// tryReserveMemory reserves estimateBytes if the budget has room for it; if
+// memory.current cannot be read, it does not, to be safe
+func (s *Server) tryReserveMemory(estimateBytes int64) bool {
+	cur, err := readCgroupMemoryCurrent(s.cfg.CgroupV2Root)
+	if err != nil || !s.memPressureOK() {
+		return false
+	}
 	s.mu.Lock()
-	if estimateBytes > s.memReservedBytes {
-		s.memReservedBytes = 0
-	} else {
-		s.memReservedBytes -= estimateBytes
+	defer s.mu.Unlock()
+	if cur+s.memReservedBytes+estimateBytes > s.memBudgetBytes {
+		return false
 	}
-	s.mu.Unlock()
+	s.memReservedBytes += estimateBytes
+	return true
 }
 
-// readCgroupMemoryMax reads the memory.max value from cgroups v2
-func readCgroupMemoryMax(root string) (int64, error) {
-	if root == "" {
-		return 0, fmt.Errorf("cgroup root not set")
+// leaveMemoryQueue removes wake from the memory waiters, waking the next one if
+// wake was first
+func (s *Server) leaveMemoryQueue(wake chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.Index(s.memWaiters, wake)
+	if i < 0 {
+		return
 	}
-	b, err := os.ReadFile(filepath.Join(root, "memory.max"))
-	if err != nil {
-		return 0, err
+	s.memWaiters = slices.Delete(s.memWaiters, i, i+1)
+	if i == 0 {
+		s.wakeMemoryWaiterLocked()
 	}
-	s := strings.TrimSpace(string(b))
-	if s == "max" {
-		return 0, nil
+}
+
+// memPressureOK reports whether memory.pressure is below memPressureMaxAvg10;
+// an unreadable pressure file does not hold jobs back
+func (s *Server) memPressureOK() bool {
+	if s.cfg.MemPressureMaxAvg10 <= 0 {
+		return true
 	}
-	var v int64
-	_, err = fmt.Sscanf(s, "%d", &v)
-	if err != nil {
-		return 0, err
+	p, err := readCgroupMemoryPressure(s.cfg.CgroupV2Root)
+	return err != nil || p <= s.cfg.MemPressureMaxAvg10
+}
+
+// wakeMemoryWaiter makes the first job waiting for memory re-check the budget
+func (s *Server) wakeMemoryWaiter() {
+	s.mu.Lock()
+	s.wakeMemoryWaiterLocked()
+	s.mu.Unlock()
+}
+
+// wakeMemoryWaiterLocked is wakeMemoryWaiter with s.mu held; a wakeup the job
+// has not taken yet is not doubled
+func (s *Server) wakeMemoryWaiterLocked() {
+	if len(s.memWaiters) == 0 {
+		return
+	}
+	select {
+	case s.memWaiters[0] <- struct{}{}:
+	default:
 	}
-	return v, nil
 }
 
-// readCgroupMemoryCurrent reads the memory.current value from cgroups v2
-func readCgroupMemoryCurrent(root string) (int64, error) {
-	b, err := os.ReadFile(filepath.Join(root, "memory.current"))
-	if err != nil {
-		return 0, err
+// startMemoryWatcher wakes the first waiting job on cgroup memory events and
+// periodically, besides the wakeup each released reservation gives
+func (s *Server) startMemoryWatcher() {
+	if err := watchCgroupMemoryEvents(s.cfg.CgroupV2Root, s.wakeMemoryWaiter); err != nil {
+		log.Printf("memory.events watch unavailable, re-checking every %s: %v", memRecheckInterval, err)
 	}
-	var v int64
-	_, err = fmt.Sscanf(strings.TrimSpace(string(b)), "%d", &v)
-	if err != nil {
-		return 0, err
+	go func() {
+		ticker := time.NewTicker(memRecheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.wakeMemoryWaiter()
+		}
+	}()
+}
+
+// releaseMemory releases the memory reservation for a job
+func (s *Server) releaseMemory(estimateBytes int64) {
+	s.mu.Lock()
+	if estimateBytes > s.memReservedBytes {
+		s.memReservedBytes = 0
+	} else {
+		s.memReservedBytes -= estimateBytes
 	}
-	return v, nil
-}
\ No newline at end of file
+	// The freed reservation may let the first waiting job in right away
+	s.wakeMemoryWaiterLocked()
+	s.mu.Unlock()
+}
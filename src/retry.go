@@ -0,0 +1,69 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+// transientPattern matches lines of toolchain output reporting failures that a
+// second attempt can get past: emscripten cache races between concurrent jobs, its
+// cache lock, and the compiler running out of memory. The message has to start the
+// line, after at most "tool: level: " prefixes, so diagnostics quoting the user's
+// text further on, such as undefined symbol names, do not match.
+var transientPattern = regexp.MustCompile(`(?i)^([\w.:+-]+: )*(` +
+	`cache is locked|timed out waiting for (the )?cache lock|` +
+	`(FileNotFoundError|FileExistsError|\[Errno \d+\] No such file or directory).*[/\\]cache[/\\]|` +
+	`LLVM ERROR: out of memory|terminate called after throwing an instance of 'std::bad_alloc'|` +
+	`(OSError: \[Errno 12\] )?Cannot allocate memory)`)
+
+// diagnosticPattern matches the lines of compiler diagnostics, "file:line:" and the
+// source lines they quote, whose text the user's code controls, e.g. with #warning
+var diagnosticPattern = regexp.MustCompile(`^(\S+:\d+(:\d+)?: |\s*\d*\s*\| )`)
+
+// transientFailure reports whether a failed build is worth retrying. Timeouts are
+// not, and neither is anything the user's code can cause, such as compile errors.
+func transientFailure(ctx context.Context, out []byte, runErr error) bool {
+	if runErr == nil || ctx.Err() != nil {
+		return false
+	}
+	// A compiler killed by SIGKILL without a timeout was most likely the OOM killer
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() && ws.Signal() == syscall.SIGKILL {
+			return true
+		}
+	}
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if !diagnosticPattern.Match(line) && transientPattern.Match(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay returns the backoff before retry number attempt (from 1), doubling each time
+func (s *Server) retryDelay(attempt int) time.Duration {
+	return time.Duration(s.cfg.CompileRetryBackoffMs) * time.Millisecond << (attempt - 1)
+}
+
+// buildWithRetries runs build, repeating it up to compileRetries times while it
+// fails transiently; it returns the last attempt's output and the number of retries
+func (s *Server) buildWithRetries(ctx context.Context, build func() (cmdOutput, error, error)) (out cmdOutput, retries int, runErr, err error) {
+	out, runErr, err = build()
+	for err == nil && retries < s.cfg.CompileRetries && transientFailure(ctx, out.combined(), runErr) {
+		retries++
+		select {
+		case <-ctx.Done():
+			return out, retries - 1, runErr, nil
+		case <-time.After(s.retryDelay(retries)):
+		}
+		out, runErr, err = build()
+	}
+	return out, retries, runErr, err
+}
@@ -0,0 +1,74 @@
+package src
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// role is what a caller may do; each role includes the ones below it
+type role int
+
+const (
+	roleAnonymous role = iota
+	roleUser
+	roleAdmin
+)
+
+// roleNames are the roles as named in endpointRoles
+var roleNames = map[string]role{"anonymous": roleAnonymous, "user": roleUser, "admin": roleAdmin}
+
+// roleOf returns the role r authenticates as: admin with adminToken or an OIDC
+// token granting oidcAdminRole, user with an API key or any other OIDC token
+func (s *Server) roleOf(r *http.Request) role {
+	if s.isAdmin(r) {
+		return roleAdmin
+	}
+	if _, ok := s.oidcClaims(r); ok || s.validAPIKey(r) {
+		return roleUser
+	}
+	return roleAnonymous
+}
+
+// endpointRole returns the role API path requires: admin for /admin/, else as
+// set in endpointRoles, else user with requireAPIKey and anonymous without
+func (s *Server) endpointRole(path string) role {
+	if strings.HasPrefix(path, "/admin/") {
+		return roleAdmin
+	}
+	if name, ok := s.cfg.EndpointRoles[path]; ok {
+		return roleNames[name]
+	}
+	if s.cfg.RequireAPIKey {
+		return roleUser
+	}
+	return roleAnonymous
+}
+
+// withRole refuses requests below min: with 401 when they could authenticate
+// further, with 403 when they did and still fall short
+func (s *Server) withRole(min role, next http.HandlerFunc) http.HandlerFunc {
+	if min == roleAnonymous {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := s.roleOf(r)
+		if got >= min {
+			next(w, r)
+			return
+		}
+		if got == roleAnonymous {
+			writeUnauthorized(w)
+			return
+		}
+		writeError(w, http.StatusForbidden, codeForbidden, "", "this endpoint requires the admin role")
+	}
+}
+
+// roleTimeout caps timeout for anonymous callers at anonymousCompileTimeoutSecs
+func (s *Server) roleTimeout(r *http.Request, timeout time.Duration) time.Duration {
+	if s.cfg.AnonymousCompileTimeoutSecs <= 0 || s.roleOf(r) != roleAnonymous {
+		return timeout
+	}
+	return min(timeout, time.Duration(s.cfg.AnonymousCompileTimeoutSecs)*time.Second)
+}
@@ -0,0 +1,119 @@
+package src
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// includeDirectivePattern matches #include-like directives, including the %: digraph
+var includeDirectivePattern = regexp.MustCompile(`^\s*(?:#|%:)\s*(include|include_next|import|embed)\b\s*(.*)$`)
+
+// hasIncludePattern matches __has_include / __has_include_next / __has_embed operands
+var hasIncludePattern = regexp.MustCompile(`__has_(include|include_next|embed)\s*\(\s*([^)]*)`)
+
+// incbinPattern matches assembler directives that read files, e.g. in inline asm
+var incbinPattern = regexp.MustCompile(`\.(?:incbin|include)\s+\\?"([^"\\]*)`)
+
+// checkSourcePaths applies the include scan when scanIncludes is on and jobs run
+// without nsjail, where the toolchain sees the host filesystem
+func (s *Server) checkSourcePaths(code string) error {
+	if !s.cfg.ScanIncludes || s.cfg.NsJailEnabled {
+		return nil
+	}
+	if err := scanIncludes(code); err != nil {
+		return fmt.Errorf("source rejected: %w", err)
+	}
+	return nil
+}
+
+// scanIncludes rejects sources whose preprocessor or assembler would read files
+// outside the job directory: absolute or parent-relative paths, and computed
+// includes whose target cannot be checked
+func scanIncludes(code string) error {
+	code = stripComments(strings.ReplaceAll(strings.ReplaceAll(code, "\\\r\n", ""), "\\\n", ""))
+	for n, line := range strings.Split(code, "\n") {
+		if m := includeDirectivePattern.FindStringSubmatch(line); m != nil {
+			operand := strings.TrimSpace(m[2])
+			if operand == "" || (operand[0] != '<' && operand[0] != '"') {
+				return fmt.Errorf("line %d: computed #%s is not allowed", n+1, m[1])
+			}
+			if err := checkIncludePath(operand); err != nil {
+				return fmt.Errorf("line %d: %v", n+1, err)
+			}
+		}
+		for _, m := range hasIncludePattern.FindAllStringSubmatch(line, -1) {
+			if m[2] == "" || (m[2][0] != '<' && m[2][0] != '"') {
+				return fmt.Errorf("line %d: computed __has_%s is not allowed", n+1, m[1])
+			}
+			if err := checkIncludePath(m[2]); err != nil {
+				return fmt.Errorf("line %d: %v", n+1, err)
+			}
+		}
+		for _, m := range incbinPattern.FindAllStringSubmatch(line, -1) {
+			if err := checkIncludePath(`"` + m[1] + `"`); err != nil {
+				return fmt.Errorf("line %d: %v", n+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkIncludePath rejects a quoted or bracketed header name that leaves the search path
+func checkIncludePath(operand string) error {
+	end := strings.IndexAny(operand[1:], `>"`)
+	if end < 0 {
+		return fmt.Errorf("unterminated include path %s", operand)
+	}
+	p := strings.ReplaceAll(operand[1:end+1], `\`, "/")
+	if strings.HasPrefix(p, "/") || (len(p) > 1 && p[1] == ':') {
+		return fmt.Errorf("absolute include path %q is not allowed", p)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return fmt.Errorf("include path %q leaves the include directories", p)
+		}
+	}
+	return nil
+}
+
+// stripComments blanks out C and C++ comments, leaving string and character literals intact
+func stripComments(code string) string {
+	var b strings.Builder
+	b.Grow(len(code))
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '"' || c == '\'':
+			// copy the literal through its closing quote
+			j := i + 1
+			for j < len(code) && code[j] != c && code[j] != '\n' {
+				if code[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(code) {
+				j = len(code) - 1
+			}
+			b.WriteString(code[i : j+1])
+			i = j
+		case c == '/' && i+1 < len(code) && code[i+1] == '/':
+			for i < len(code) && code[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case c == '/' && i+1 < len(code) && code[i+1] == '*':
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			// keep line numbers stable for error messages
+			b.WriteString(" " + strings.Repeat("\n", strings.Count(code[i:i+2+end], "\n")))
+			i += end + 3
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// selftestSource is the canary program the self-test compiles
+const selftestSource = "#include <stdio.h>\nint main(void) { printf(\"ok\\n\"); return 0; }\n"
+
+// runSelftest compiles the canary program through the full compile pipeline and
+// checks the published module, then removes its artifacts again
+func (s *Server) runSelftest(ctx context.Context) SelftestResult {
+	start := time.Now()
+	res := SelftestResult{Time: start.UTC()}
+	err := s.selftestCompile(ctx, &res)
+	res.DurationMs = time.Since(start).Milliseconds()
+	res.OK = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	s.selftestMu.Lock()
+	s.lastSelftest = &res
+	s.selftestMu.Unlock()
+	return res
+}
+
+// selftestCompile does the work of runSelftest, recording the job it ran in res
+func (s *Server) selftestCompile(ctx context.Context, res *SelftestResult) error {
+	body, _ := json.Marshal(CompileRequest{Code: selftestSource, Type: "c"})
+	r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/v"+apiVersion+"/compile", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.HandleCompile(rec, r)
+
+	var resp CompileResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.ID == "" {
+		var envelope ErrorResponse
+		if json.Unmarshal(rec.Body.Bytes(), &envelope) == nil && envelope.Error.Message != "" {
+			return fmt.Errorf("compile refused with %d: %s", rec.Code, envelope.Error.Message)
+		}
+		return fmt.Errorf("compile answered %d", rec.Code)
+	}
+	res.JobID = resp.ID
+	artDir := filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, resp.ID)
+	defer func() {
+		_ = os.RemoveAll(artDir)
+		_ = os.Remove(s.artifactMetaPath(resp.ID))
+	}()
+	if !resp.OK {
+		if resp.Error == "" {
+			return errors.New("compile failed without output")
+		}
+		return fmt.Errorf("compile failed: %s", resp.Error)
+	}
+	b, err := os.ReadFile(filepath.Join(artDir, s.cfg.OutputName+".wasm"))
+	if err != nil {
+		return fmt.Errorf("published module: %w", err)
+	}
+	if !bytes.HasPrefix(b, wasmMagic) {
+		return errors.New("published module is not a wasm binary")
+	}
+	return nil
+}
+
+// handleSelftest serves POST /admin/selftest, running the self-test and answering
+// its result, with status 503 when it failed
+func (s *Server) handleSelftest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	res := s.runSelftest(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if !res.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// startSelftestLoop runs the self-test every selftestIntervalMins, alerting on failures
+func (s *Server) startSelftestLoop(ctx context.Context) {
+	if s.cfg.SelftestIntervalMins <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.cfg.SelftestIntervalMins) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if s.draining.Load() {
+				continue
+			}
+			if res := s.runSelftest(ctx); !res.OK {
+				s.alert("selftest-failed", "canary compile failed after %d ms: %s", res.DurationMs, res.Error)
+			}
+		}
+	}()
+}
@@ -2,24 +2,78 @@ package src
 
 import (
 	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Server represents the HTTP server and its configuration
 type Server struct {
-	cfg       Config
-	httpSrv   *http.Server
-	onceMkDir sync.Once
+	cfg         Config
+	httpSrv     *http.Server
+	artifactSrv *http.Server // separate artifact listener, if configured
+	egressSrv   *http.Server // CONNECT proxy for jobs with network access
+	onceMkDir   sync.Once
 	// resource gating state
 	mu               sync.Mutex
 	memBudgetBytes   int64
 	memReservedBytes int64
+	memWaiters       []chan struct{} // jobs waiting for memory, first in line first
+	memWatchOnce     sync.Once
+	// idempotency keys of recent /compile requests
+	idemMu sync.Mutex
+	idem   map[string]*idempotencyEntry
+	// sum of the recorded response bodies in idem
+	idemBytes int
+	// recent compile health for load shedding
+	shed loadShedder
+	// last delivery of each operational alert
+	alerts alerter
+	// set by POST /admin/drain; drained is closed once the instance should stop
+	draining atomic.Bool
+	drained  chan struct{}
+	// build logs of running jobs by ID, for following
+	logsMu      sync.Mutex
+	runningLogs map[string]*buildLog
+	// precompiled header variants that finished building
+	pchMu    sync.Mutex
+	pchReady map[string]bool
+	// live previews by ID
+	previewMu sync.Mutex
+	previews  map[string]*preview
+	// outcome of the last self-test
+	selftestMu   sync.Mutex
+	lastSelftest *SelftestResult
+	// serializes changes to release channels
+	channelMu sync.Mutex
+	// signing keys of oidcIssuer
+	oidc oidcKeys
+	// key provenance is signed with, from signingKeyFile
+	signingKey ed25519.PrivateKey
+	// first line of the compiler's --version, for provenance
+	toolchainOnce sync.Once
+	toolchain     string
+	// API keys created through /admin/keys
+	keysMu  sync.Mutex
+	apiKeys []apiKey
+	// user arg lists and compiler commands, split once from the config
+	args                   argPolicy
+	compilerC, compilerCpp []string
+	// parsed trustedProxies
+	trustedProxies []netip.Prefix
+	// toolchain binaries of the wrong architecture, found at startup
+	archProblems []string
 }
 
 // NewServer creates a new server instance with the given configuration
@@ -27,7 +81,9 @@ func NewServer(cfg Config) *Server {
 	if cfg.ArtifactTTL == 0 {
 		cfg.ArtifactTTL = time.Duration(cfg.ArtifactTTLDays) * 24 * time.Hour
 	}
-	s := &Server{cfg: cfg}
+	// ValidateConfig has rejected entries that do not parse
+	trusted, _ := parseTrustedProxies(cfg.TrustedProxies)
+	s := &Server{cfg: cfg, trustedProxies: trusted, args: newArgPolicy(cfg), compilerC: strings.Fields(cfg.CompilerC), compilerCpp: strings.Fields(cfg.CompilerCpp), idem: make(map[string]*idempotencyEntry), runningLogs: make(map[string]*buildLog), pchReady: make(map[string]bool), previews: make(map[string]*preview), drained: make(chan struct{})}
 	return s
 }
 
@@ -43,6 +99,29 @@ func (s *Server) ensureDirs() error {
 		if err != nil {
 			return
 		}
+		if err = os.MkdirAll(filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactMetaDir), 0o755); err != nil {
+			return
+		}
+		if s.cfg.BuildLogMaxKB > 0 {
+			if err = os.MkdirAll(filepath.Join(s.cfg.BaseDir, s.cfg.LogsDir), 0o755); err != nil {
+				return
+			}
+		}
+		if s.cfg.ShareTTLDays > 0 {
+			if err = os.MkdirAll(filepath.Join(s.cfg.BaseDir, s.cfg.SharesDir), 0o755); err != nil {
+				return
+			}
+		}
+		if s.cfg.CcacheDir != "" {
+			if err = os.MkdirAll(s.cfg.CcacheDir, 0o775); err != nil {
+				return
+			}
+		}
+		if s.cfg.PCHDir != "" {
+			if err = os.MkdirAll(s.cfg.PCHDir, 0o755); err != nil {
+				return
+			}
+		}
 		// cgroup path optional; do not create by default
 	})
 	return err
@@ -50,16 +129,159 @@ func (s *Server) ensureDirs() error {
 
 // routes sets up the HTTP routes
 func (s *Server) routes(mux *http.ServeMux) {
-	mux.HandleFunc("/compile", s.HandleCompile)
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { 
-		w.WriteHeader(200)
-		_, _ = w.Write([]byte("ok")) 
+	api := map[string]http.HandlerFunc{
+		"/compile":       s.withBodyLimit(s.withIdempotency(s.withLoadShedding(s.HandleCompile))),
+		"/analyze":       s.withBodyLimit(s.withLoadShedding(s.HandleAnalyze)),
+		"/jobs/{id}/log": s.handleJobLog,
+	}
+	if s.cfg.MatrixMaxVariants > 0 {
+		api["/matrix"] = s.withBodyLimit(s.withLoadShedding(s.handleMatrix))
+	}
+	if s.cfg.ExamplesDir != "" {
+		api["/examples"] = s.handleExamples
+		api["/examples/{name}"] = s.handleExample
+		api["/examples/{name}/compile"] = s.handleExampleCompile
+	}
+	if s.cfg.ShareTTLDays > 0 {
+		api["/share"] = s.handleShare
+	}
+	if s.cfg.SigningKeyFile != "" {
+		api["/signing-key"] = s.handleSigningKey
+	}
+	if s.adminEnabled() {
+		api["/admin/stats"] = s.withAdmin(s.handleAdminStats)
+		api["/admin/drain"] = s.withAdmin(s.handleAdminDrain)
+		api["/admin/selftest"] = s.withAdmin(s.handleSelftest)
+		api["/admin/channels/{name}"] = s.withAdmin(s.handleChannel)
+		api["/admin/channels/{name}/rollback"] = s.withAdmin(s.handleChannelRollback)
+		api["/admin/keys"] = s.withAdmin(s.handleAPIKeys)
+		api["/admin/keys/{id}"] = s.withAdmin(s.handleAPIKey)
+		// pinning takes an authenticated caller, whatever endpointRoles allows
+		api["/artifacts/{id}/pin"] = s.withRole(roleUser, s.handleArtifactPin)
+	}
+	// The API lives under /v1; the original unversioned paths remain as deprecated aliases
+	for path, h := range api {
+		if !strings.HasPrefix(path, "/admin/") {
+			h = s.withRole(s.endpointRole(path), h)
+		}
+		h = withAPIVersion(h)
+		mux.HandleFunc("/v"+apiVersion+path, h)
+		// unversioned, an artifact path would shadow the artifact files
+		if !strings.HasPrefix(path, "/artifacts/") {
+			mux.HandleFunc(path, s.deprecatedAlias(h))
+		}
+	}
+	if s.cfg.ShareTTLDays > 0 {
+		// permalinks stay short and unversioned
+		mux.HandleFunc("/s/{slug}", s.handleShared)
+	}
+	// liveness stays up while draining, so orchestrators do not kill running jobs
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadiness)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	// Artifacts share the API listener unless they have their own address
+	if s.cfg.EnableStaticArtifacts && s.cfg.ArtifactsAddr == "" {
+		s.artifactRoutes(mux)
+	}
+}
+
+// artifactRoutes sets up the static artifact routes
+func (s *Server) artifactRoutes(mux *http.ServeMux) {
+	fs := http.StripPrefix(s.artifactsURLPrefix(),
+		http.FileServer(http.Dir(filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir))))
+	mux.Handle(s.artifactsURLPrefix()+"/", s.withArtifactHeaders(fs))
+	mux.Handle(s.artifactsURLPrefix()+"/alias/{name}/{file...}", s.withArtifactHeaders(http.HandlerFunc(s.handleAlias)))
+	mux.Handle("/channels/{name}/{file...}", s.withArtifactHeaders(http.HandlerFunc(s.handleChannelFile)))
+	if s.cfg.AllowPreview {
+		mux.HandleFunc("/preview/{id}/{file}", s.handlePreview)
+	}
+}
+
+// defaultHTMLContentSecurityPolicy lets a generated page run its own scripts and wasm
+// while sandboxing it into an opaque origin, away from cookies and storage of the host
+const defaultHTMLContentSecurityPolicy = "default-src 'none'; script-src 'self' 'unsafe-inline' 'wasm-unsafe-eval'; " +
+	"connect-src 'self'; img-src 'self' data: blob:; style-src 'self' 'unsafe-inline'; sandbox allow-scripts"
+
+// artifactContentSecurityPolicy keeps any other artifact a browser is tricked into
+// rendering from running script
+const artifactContentSecurityPolicy = "default-src 'none'; sandbox"
+
+// withArtifactHeaders adds the security headers of artifact responses. Artifacts are
+// compiled from untrusted code, so HTML pages get htmlContentSecurityPolicy and
+// htmlDisposition and everything else is forbidden from rendering as a document.
+func (s *Server) withArtifactHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		switch strings.ToLower(path.Ext(r.URL.Path)) {
+		case ".html", ".htm":
+			if s.cfg.HTMLContentSecurityPolicy != "" {
+				h.Set("Content-Security-Policy", s.cfg.HTMLContentSecurityPolicy)
+			}
+			h.Set("Content-Disposition", s.htmlDisposition())
+		default:
+			h.Set("Content-Security-Policy", artifactContentSecurityPolicy)
+			if s.cfg.AllowHTMLOutput {
+				// sandboxed pages have an opaque origin, so their wasm fetches are cross-origin
+				h.Set("Access-Control-Allow-Origin", "*")
+			}
+		}
+		for name, value := range s.cfg.ArtifactHeaders {
+			h.Set(name, value)
+		}
+		next.ServeHTTP(w, r)
 	})
-	if s.cfg.EnableStaticArtifacts {
-		fs := http.StripPrefix("/"+strings.TrimPrefix(s.cfg.ArtifactsDir, "/"), 
-			http.FileServer(http.Dir(filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir))))
-		mux.Handle("/"+strings.TrimPrefix(s.cfg.ArtifactsDir, "/")+"/", fs)
+}
+
+// htmlDisposition resolves htmlDisposition; "auto" only renders pages inline when
+// artifacts have an origin of their own, never next to the compile API
+func (s *Server) htmlDisposition() string {
+	switch s.cfg.HTMLDisposition {
+	case "inline":
+		return "inline"
+	case "auto":
+		if s.cfg.ArtifactsAddr != "" || s.cfg.ArtifactsBaseURL != "" {
+			return "inline"
+		}
 	}
+	return "attachment"
+}
+
+// handleHealthz reports that the server is up
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(200)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// handleReadiness reports that the API is up, failing once the instance drains, or
+// from the start when its toolchain cannot run on the host, so load balancers stop
+// routing new jobs to it
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	if len(s.archProblems) > 0 {
+		http.Error(w, "toolchain architecture mismatch:\n"+strings.Join(s.archProblems, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	handleHealthz(w, r)
+}
+
+// artifactsURLPrefix returns the URL path artifacts are served under
+func (s *Server) artifactsURLPrefix() string {
+	// ArtifactsDir is a filesystem path; URLs always use forward slashes
+	return "/" + strings.TrimPrefix(filepath.ToSlash(s.cfg.ArtifactsDir), "/")
+}
+
+// artifactsBaseURL returns the URL artifact links in responses to r start with,
+// absolute when artifacts are published under their own origin
+func (s *Server) artifactsBaseURL(r *http.Request) string {
+	if s.cfg.ArtifactsBaseURL != "" || s.cfg.ArtifactsAddr != "" {
+		return strings.TrimSuffix(s.cfg.ArtifactsBaseURL, "/") + s.artifactsURLPrefix()
+	}
+	// served next to the API, so under its base path
+	return s.publicURL(r, s.artifactsURLPrefix())
 }
 
 // Start starts the HTTP server
@@ -67,24 +289,109 @@ func (s *Server) Start(ctx context.Context) error {
 	if err := s.ensureDirs(); err != nil {
 		return err
 	}
+	if err := s.loadAPIKeys(); err != nil {
+		return fmt.Errorf("loading API keys: %w", err)
+	}
+	if err := s.loadSigningKey(); err != nil {
+		return fmt.Errorf("loading signingKeyFile: %w", err)
+	}
+	s.archProblems = s.checkToolchainArch()
+	for _, p := range s.archProblems {
+		log.Printf("toolchain architecture mismatch: %s", p)
+	}
+	s.prepareJobsDir()
+	go s.warmPCH(ctx)
 	s.StartCleanupLoop()
+	s.startAlertMonitor(ctx)
+	s.startSelftestLoop(ctx)
 	mux := http.NewServeMux()
 	s.routes(mux)
-	s.httpSrv = &http.Server{Addr: s.cfg.Addr, Handler: logRequest(mux)}
+	s.httpSrv = &http.Server{Addr: s.cfg.Addr, Handler: withTrace(s.withOIDC(s.logRequest(s.withH2CGuard(s.withBasePath(s.withCompression(mux))))))}
+
+	// Prefer a socket handed over by systemd socket activation
+	ln, err := systemdListener()
+	if err != nil {
+		return err
+	}
+	if ln == nil {
+		ln, err = net.Listen("tcp", s.cfg.Addr)
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.startArtifactServer(); err != nil {
+		_ = ln.Close()
+		return err
+	}
+	if err := s.startEgressProxy(); err != nil {
+		_ = ln.Close()
+		return err
+	}
+	sd := newSDNotifier()
+	stopped := make(chan struct{})
 	go func() {
-		<-ctx.Done()
-		c, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer close(stopped)
+		// A drain lets running jobs finish; a signal only gives them a moment
+		grace := 3 * time.Second
+		select {
+		case <-ctx.Done():
+		case <-s.drained:
+			grace = s.longestJob()
+		}
+		sd.notify("STOPPING=1")
+		c, cancel := context.WithTimeout(context.Background(), grace)
 		defer cancel()
+		if s.artifactSrv != nil {
+			_ = s.artifactSrv.Shutdown(c)
+		}
+		if s.egressSrv != nil {
+			_ = s.egressSrv.Shutdown(c)
+		}
 		_ = s.httpSrv.Shutdown(c)
 	}()
-	log.Printf("emcc-sandboxd listening on %s", s.cfg.Addr)
-	return s.httpSrv.ListenAndServe()
+	log.Printf("emcc-sandboxd listening on %s", ln.Addr())
+	sd.notify("READY=1")
+	sd.runWatchdog(ctx)
+	err = s.serve(s.httpSrv, ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		// Serve returns as soon as shutdown starts; wait for requests to finish
+		<-stopped
+	}
+	return err
+}
+
+// startArtifactServer serves artifacts on ArtifactsAddr with its own middleware chain,
+// so the compile API can stay private while artifacts face the public
+func (s *Server) startArtifactServer() error {
+	if !s.cfg.EnableStaticArtifacts || s.cfg.ArtifactsAddr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	s.artifactRoutes(mux)
+	mux.HandleFunc("/healthz", handleHealthz)
+	s.artifactSrv = &http.Server{Addr: s.cfg.ArtifactsAddr, Handler: withTrace(s.logRequest(s.withH2CGuard(mux)))}
+	ln, err := net.Listen("tcp", s.cfg.ArtifactsAddr)
+	if err != nil {
+		return err
+	}
+	log.Printf("serving artifacts on %s", ln.Addr())
+	go func() {
+		if err := s.serve(s.artifactSrv, ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("artifact server: %v", err)
+		}
+	}()
+	return nil
 }
 
 // logRequest is a middleware that logs HTTP requests
-func logRequest(next http.Handler) http.Handler {
+func (s *Server) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
+		if c, ok := s.oidcClaims(r); ok {
+			// the subject names the tenant behind OIDC-authenticated requests
+			log.Printf("%s %s client=%s trace=%s sub=%s", r.Method, r.URL.Path, s.clientIP(r), traceID(r.Context()), c.Subject)
+		} else {
+			log.Printf("%s %s client=%s trace=%s", r.Method, r.URL.Path, s.clientIP(r), traceID(r.Context()))
+		}
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
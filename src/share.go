@@ -0,0 +1,167 @@
+package src
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxShareBytes bounds the stored size of one shared build
+const maxShareBytes = 256 << 10
+
+// shareSlugPattern matches the slugs newShareSlug generates
+var shareSlugPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8}$`)
+
+// newShareSlug returns a random 8 character URL-safe slug
+func newShareSlug() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sharePath returns where the share with slug is stored
+func (s *Server) sharePath(slug string) string {
+	return filepath.Join(s.cfg.BaseDir, s.cfg.SharesDir, slug+".json")
+}
+
+// handleShare serves POST /share, storing a compile request under a new slug
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	var sh Share
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxShareBytes)).Decode(&sh); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, codeInvalidField, "code", fmt.Sprintf("shared builds are limited to %d KB", maxShareBytes>>10))
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, "", "invalid JSON")
+		return
+	}
+	if strings.TrimSpace(sh.Code) == "" {
+		writeError(w, http.StatusBadRequest, codeMissingField, "code", "code is required")
+		return
+	}
+	if _, ok := parseLang(sh.Type); !ok {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "type", "type must be 'c' or 'cpp'")
+		return
+	}
+	if sh.ArtifactID != "" && !s.artifactExists(sh.ArtifactID) {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "artifactId", "no artifact "+sh.ArtifactID)
+		return
+	}
+	// keys of one-off requests make no sense in a permalink
+	sh.IdempotencyKey = ""
+	slug, err := newShareSlug()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	sh.Slug = slug
+	sh.Created = time.Now().UTC()
+	sh.Expires = sh.Created.Add(time.Duration(s.cfg.ShareTTLDays) * 24 * time.Hour)
+	b, _ := json.Marshal(sh)
+	if err := os.WriteFile(s.sharePath(slug), b, 0o644); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", s.publicURL(r, "/s/"+slug))
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(sh)
+}
+
+// handleShared serves GET /s/{slug}: the shared source and args, and the URLs of
+// the shared build's artifacts while they last
+func (s *Server) handleShared(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	slug := r.PathValue("slug")
+	if !shareSlugPattern.MatchString(slug) {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no shared build "+slug)
+		return
+	}
+	b, err := os.ReadFile(s.sharePath(slug))
+	if err != nil {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no shared build "+slug)
+		return
+	}
+	var sh Share
+	if err := json.Unmarshal(b, &sh); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if time.Now().After(sh.Expires) {
+		writeError(w, http.StatusNotFound, codeNotFound, "", "no shared build "+slug)
+		return
+	}
+	if sh.ArtifactID != "" {
+		sh.Files = s.artifactFiles(r, sh.ArtifactID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sh)
+}
+
+// artifactExists reports whether the artifacts of job id are still published
+func (s *Server) artifactExists(id string) bool {
+	if !jobIDPattern.MatchString(id) {
+		return false
+	}
+	fi, err := os.Stat(filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, id))
+	return err == nil && fi.IsDir()
+}
+
+// artifactFiles maps the published files of job id to their URLs; nil once they expired
+func (s *Server) artifactFiles(r *http.Request, id string) map[string]string {
+	if !s.artifactExists(id) {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(s.cfg.BaseDir, s.cfg.ArtifactsDir, id))
+	if err != nil {
+		return nil
+	}
+	files := make(map[string]string)
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			files[e.Name()] = fmt.Sprintf("%s/%s/%s", s.artifactsBaseURL(r), id, e.Name())
+		}
+	}
+	return files
+}
+
+// pruneShares removes shares past their expiry
+func (s *Server) pruneShares() {
+	if s.cfg.ShareTTLDays <= 0 {
+		return
+	}
+	dir := filepath.Join(s.cfg.BaseDir, s.cfg.SharesDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		s.alert("cleanup-error", "reading %s: %v", dir, err)
+		return
+	}
+	ttl := time.Duration(s.cfg.ShareTTLDays) * 24 * time.Hour
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil || !fi.Mode().IsRegular() || time.Since(fi.ModTime()) <= ttl {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			s.alert("cleanup-error", "removing expired share: %v", err)
+		}
+	}
+}
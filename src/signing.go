@@ -0,0 +1,120 @@
+package src
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Files a signed build publishes alongside its outputs
+const (
+	provenanceName    = "provenance.json"
+	provenanceSigName = "provenance.json.sig"
+)
+
+// loadSigningKey reads the Ed25519 key of signingKeyFile, a PKCS#8 PEM file as
+// written by openssl genpkey -algorithm ed25519
+func (s *Server) loadSigningKey() error {
+	if s.cfg.SigningKeyFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.cfg.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return errors.New("no PEM block")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return fmt.Errorf("want an Ed25519 key, got %T", key)
+	}
+	s.signingKey = edKey
+	return nil
+}
+
+// toolchainVersion returns the first line of the C compiler's --version, looked
+// up once
+func (s *Server) toolchainVersion() string {
+	s.toolchainOnce.Do(func() {
+		argv := append(strings.Fields(s.cfg.CompilerC), "--version")
+		out, err := exec.Command(argv[0], argv[1:]...).Output()
+		s.toolchain = firstLine(out)
+		if err != nil || s.toolchain == "" {
+			s.toolchain = "unknown"
+		}
+	})
+	return s.toolchain
+}
+
+// signProvenance writes the provenance of job id, built from outputs in jobDir by
+// argv, and its signature into jobDir, returning the outputs to publish with them
+func (s *Server) signProvenance(id, jobDir string, argv, outputs []string) ([]string, error) {
+	if s.signingKey == nil {
+		return outputs, nil
+	}
+	files, err := hashFiles(jobDir, outputs)
+	if err != nil {
+		return nil, err
+	}
+	p := Provenance{ID: id, Created: time.Now().UTC(), Toolchain: s.toolchainVersion(), Argv: argv, Files: files}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(s.signingKey, b))
+	if err := os.WriteFile(filepath.Join(jobDir, provenanceName), b, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(jobDir, provenanceSigName), []byte(sig+"\n"), 0o644); err != nil {
+		return nil, err
+	}
+	return append(outputs, provenanceName, provenanceSigName), nil
+}
+
+// hashFiles returns the hex-encoded SHA-256 of each of names in dir
+func hashFiles(dir string, names []string) (map[string]string, error) {
+	sums := make(map[string]string, len(names))
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		sums[name] = hex.EncodeToString(sum[:])
+	}
+	return sums, nil
+}
+
+// handleSigningKey serves GET /signing-key, the PEM public key provenance is
+// signed with
+func (s *Server) handleSigningKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w)
+		return
+	}
+	der, err := x509.MarshalPKIXPublicKey(s.signingKey.Public())
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	_ = pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
@@ -0,0 +1,106 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// sourceScanTimeout bounds one run of the source scanner
+const sourceScanTimeout = 30 * time.Second
+
+// scanFinding is a source the scanner flagged, with its verdict
+type scanFinding struct {
+	verdict string
+}
+
+func (e *scanFinding) Error() string {
+	if e.verdict == "" {
+		return "source rejected by scanner"
+	}
+	return "source rejected by scanner: " + e.verdict
+}
+
+// scanSource passes code to sourceScanCommand and sourceScanURL, when set. It
+// returns a *scanFinding for flagged sources and other errors when a scanner
+// could not give a verdict, in which case the source is not compiled either.
+func (s *Server) scanSource(ctx context.Context, code string) error {
+	if len(s.cfg.SourceScanCommand) == 0 && s.cfg.SourceScanURL == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, sourceScanTimeout)
+	defer cancel()
+	if len(s.cfg.SourceScanCommand) > 0 {
+		if err := s.scanWithCommand(ctx, code); err != nil {
+			return err
+		}
+	}
+	if s.cfg.SourceScanURL != "" {
+		return s.scanWithService(ctx, code)
+	}
+	return nil
+}
+
+// scanWithCommand runs sourceScanCommand with code on stdin. Like clamdscan, it
+// exits 0 for clean input and 1 for findings, named on its output.
+func (s *Server) scanWithCommand(ctx context.Context, code string) error {
+	argv := s.cfg.SourceScanCommand
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = strings.NewReader(code)
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return &scanFinding{verdict: firstLine(out)}
+	}
+	if err != nil {
+		return fmt.Errorf("source scanner: %v: %s", err, firstLine(out))
+	}
+	return nil
+}
+
+// scanWithService posts code to sourceScanURL, which answers 2xx for clean
+// input and 403 for findings, named in the body
+func (s *Server) scanWithService(ctx context.Context, code string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.SourceScanURL, strings.NewReader(code))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("source scanner: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode == http.StatusForbidden:
+		return &scanFinding{verdict: firstLine(body)}
+	}
+	return fmt.Errorf("source scanner: %s returned %s", s.cfg.SourceScanURL, resp.Status)
+}
+
+// firstLine shortens command or service output to its first line, for messages
+func firstLine(out []byte) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if len(line) > 200 {
+		line = line[:200]
+	}
+	return strings.TrimSpace(line)
+}
+
+// writeScanError answers a failed scan: 400 for findings, 503 when no verdict was had
+func writeScanError(w http.ResponseWriter, err error) {
+	var finding *scanFinding
+	if errors.As(err, &finding) {
+		writeError(w, http.StatusBadRequest, codeInvalidField, "code", finding.Error())
+		return
+	}
+	writeError(w, http.StatusServiceUnavailable, codeScanUnavailable, "", err.Error())
+}
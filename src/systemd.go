@@ -0,0 +1,98 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdListenFDsStart is the first file descriptor passed by systemd socket activation
+const sdListenFDsStart = 3
+
+// systemdListener returns the listener inherited via socket activation, or nil if none was passed
+func systemdListener() (net.Listener, error) {
+	defer func() {
+		// Do not leak activation state into compiler processes
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	if n > 1 {
+		log.Printf("systemd passed %d sockets; using the first", n)
+	}
+	f := os.NewFile(uintptr(sdListenFDsStart), "LISTEN_FD_3")
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket activation: %w", err)
+	}
+	_ = f.Close() // FileListener holds its own dup
+	return ln, nil
+}
+
+// sdNotifier sends service state notifications to systemd
+type sdNotifier struct {
+	addr     string
+	watchdog time.Duration
+}
+
+// newSDNotifier reads the notification socket and watchdog interval from the environment
+func newSDNotifier() *sdNotifier {
+	n := &sdNotifier{addr: os.Getenv("NOTIFY_SOCKET")}
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		pid, err := strconv.Atoi(os.Getenv("WATCHDOG_PID"))
+		if err != nil || pid == os.Getpid() {
+			n.watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+	os.Unsetenv("NOTIFY_SOCKET")
+	os.Unsetenv("WATCHDOG_USEC")
+	os.Unsetenv("WATCHDOG_PID")
+	return n
+}
+
+// notify sends a state string such as READY=1; it is a no-op outside systemd
+func (n *sdNotifier) notify(state string) {
+	if n.addr == "" {
+		return
+	}
+	conn, err := net.Dial("unixgram", n.addr)
+	if err != nil {
+		log.Printf("sd_notify %s: %v", state, err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Printf("sd_notify %s: %v", state, err)
+	}
+}
+
+// runWatchdog pings the systemd watchdog at half its interval until ctx is done
+func (n *sdNotifier) runWatchdog(ctx context.Context) {
+	if n.addr == "" || n.watchdog <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(n.watchdog / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n.notify("WATCHDOG=1")
+			}
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package src
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// traceparentPattern matches a W3C Trace Context header: version-traceid-parentid-flags
+var traceparentPattern = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// traceKey is the context key of the request's traceContext
+type traceKey struct{}
+
+// traceContext identifies a request within a distributed trace
+type traceContext struct {
+	traceID string
+	spanID  string // the daemon's own span for the request
+	flags   string
+}
+
+// withTrace continues the trace of an incoming traceparent header, or starts a new
+// one, and reports the daemon's span in a traceresponse header
+func withTrace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc := parseTraceparent(r.Header.Get("traceparent"))
+		if tc.traceID == "" {
+			tc.traceID, _ = randomID(16)
+			tc.flags = "00"
+		}
+		tc.spanID, _ = randomID(8)
+		w.Header().Set("traceresponse", "00-"+tc.traceID+"-"+tc.spanID+"-"+tc.flags)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), traceKey{}, tc)))
+	})
+}
+
+// parseTraceparent returns the trace of a valid traceparent header, or a zero traceContext
+func parseTraceparent(h string) traceContext {
+	m := traceparentPattern.FindStringSubmatch(strings.TrimSpace(h))
+	// version ff and all-zero IDs are invalid per the spec
+	if m == nil || m[1] == "ff" || strings.Trim(m[2], "0") == "" || strings.Trim(m[3], "0") == "" {
+		return traceContext{}
+	}
+	return traceContext{traceID: m[2], flags: m[4]}
+}
+
+// traceID returns the trace ID of the request, or "" if it did not pass through withTrace
+func traceID(ctx context.Context) string {
+	tc, _ := ctx.Value(traceKey{}).(traceContext)
+	return tc.traceID
+}
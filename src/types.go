@@ -4,35 +4,445 @@ import "time"
 
 // Config holds all configuration for the emcc-sandboxd service
 type Config struct {
-	WorkingDir            string        `json:"workingDir"` // Working directory for the service, defaults to current dir
-	Addr                  string        `json:"addr"`
-	BaseDir               string        `json:"baseDir"`
-	JobsDir               string        `json:"jobsDir"`
-	ArtifactsDir          string        `json:"artifactsDir"`
-	EnableStaticArtifacts bool          `json:"enableStaticArtifacts"`
-	ArtifactTTL           time.Duration `json:"-"`
-	ArtifactTTLDays       int           `json:"artifactTTLDays"`
-	CleanupIntervalMins   int           `json:"cleanupIntervalMins"`
-	DefaultArgs           []string      `json:"defaultArgs"`
-	NsJailEnabled         bool          `json:"nsjailEnabled"`
-	NsJailPath            string        `json:"nsjailPath"`
-	CgroupV2Root          string        `json:"cgroupV2Root"`
-	EnableResourceGating  bool          `json:"enableResourceGating"`
-	JobMemoryEstimateMB   int64         `json:"jobMemoryEstimateMB"`
+	WorkingDir                  string                   `json:"workingDir"` // Working directory for the service, defaults to current dir
+	Addr                        string                   `json:"addr"`
+	BaseDir                     string                   `json:"baseDir"`
+	JobsDir                     string                   `json:"jobsDir"`
+	JobsTmpfsMB                 int                      `json:"jobsTmpfsMB"` // Mount a tmpfs of this size on jobsDir at startup; 0 keeps it on disk
+	ArtifactsDir                string                   `json:"artifactsDir"`
+	LogsDir                     string                   `json:"logsDir"`          // Where compiler output of jobs is retained, under baseDir
+	BuildLogMaxKB               int                      `json:"buildLogMaxKB"`    // Size cap of a retained build log; 0 disables retention
+	BuildLogTTLHours            int                      `json:"buildLogTTLHours"` // How long build logs are kept
+	SharesDir                   string                   `json:"sharesDir"`        // Where shared builds are stored, under baseDir
+	ArtifactMetaDir             string                   `json:"artifactMetaDir"`  // Where per-artifact records such as a requested expiry are kept, under baseDir
+	ShareTTLDays                int                      `json:"shareTTLDays"`     // How long shared builds are kept; 0 disables sharing
+	OutputName                  string                   `json:"outputName"`       // Base name of compiler outputs, e.g. "app" gives app.js/app.wasm
+	EnableStaticArtifacts       bool                     `json:"enableStaticArtifacts"`
+	ArtifactsAddr               string                   `json:"artifactsAddr"`             // Separate listen address for artifacts; empty serves them on addr
+	TLSCertFile                 string                   `json:"tlsCertFile"`               // Certificate (chain) to serve HTTPS with on addr and artifactsAddr; empty serves plain HTTP
+	TLSKeyFile                  string                   `json:"tlsKeyFile"`                // Private key of tlsCertFile
+	HTTP2                       bool                     `json:"http2"`                     // Negotiate HTTP/2 with TLS clients
+	H2C                         bool                     `json:"h2c"`                       // Accept cleartext HTTP/2 from trustedProxies
+	BasePath                    string                   `json:"basePath"`                  // Path prefix all routes are mounted under, e.g. /emcc
+	AbsoluteURLs                bool                     `json:"absoluteURLs"`              // Make URLs in responses absolute, using X-Forwarded-Proto/-Host from trusted proxies
+	TrustedProxies              []string                 `json:"trustedProxies"`            // Addresses or CIDRs of reverse proxies whose X-Forwarded-* headers are believed
+	ArtifactsBaseURL            string                   `json:"artifactsBaseURL"`          // Origin used in artifact URLs, e.g. https://cdn.example.com; empty gives relative URLs
+	AllowHTMLOutput             bool                     `json:"allowHTMLOutput"`           // Permit output "html", publishing emscripten's shell page
+	AllowPreview                bool                     `json:"allowPreview"`              // Permit live previews of html builds, rendered inline with auto-reload
+	HTMLContentSecurityPolicy   string                   `json:"htmlContentSecurityPolicy"` // Content-Security-Policy sent with HTML artifacts
+	HTMLDisposition             string                   `json:"htmlDisposition"`           // "inline", "attachment", or "auto" for inline only on a separate artifact origin
+	ArtifactHeaders             map[string]string        `json:"artifactHeaders"`           // Extra headers of artifact responses, replacing built-in ones of the same name
+	ArtifactTTL                 time.Duration            `json:"-"`
+	ArtifactTTLDays             int                      `json:"artifactTTLDays"`
+	ArtifactTTLMinHours         int                      `json:"artifactTTLMinHours"` // Shortest ttlHours a compile request may ask for
+	ArtifactTTLMaxHours         int                      `json:"artifactTTLMaxHours"` // Longest ttlHours a compile request may ask for
+	CleanupIntervalMins         int                      `json:"cleanupIntervalMins"`
+	ExamplesDir                 string                   `json:"examplesDir"`   // Directory of example programs served at /examples; empty disables
+	CompilerC                   string                   `json:"compilerC"`     // Command compiling C, may start with a wrapper, e.g. "ccache emcc"
+	CompilerCpp                 string                   `json:"compilerCpp"`   // Command compiling C++, e.g. "em++"
+	CcacheDir                   string                   `json:"ccacheDir"`     // Persistent ccache directory shared by all jobs; empty disables
+	CcacheMaxSize               string                   `json:"ccacheMaxSize"` // CCACHE_MAXSIZE of ccacheDir, e.g. "5G"
+	PCHDir                      string                   `json:"pchDir"`        // Absolute directory of precompiled standard headers; empty disables
+	PCHHeaders                  []string                 `json:"pchHeaders"`    // Headers precompiled into pchDir
+	CcachePath                  string                   `json:"ccachePath"`    // ccache executable jobs compile through and cache statistics are read with
+	DefaultArgs                 []string                 `json:"defaultArgs"`
+	NsJailEnabled               bool                     `json:"nsjailEnabled"`
+	NsJailPath                  string                   `json:"nsjailPath"`
+	NsJailReadOnlyMounts        []string                 `json:"nsjailReadOnlyMounts"`  // Host directories visible read-only inside nsjail, e.g. /usr and /lib
+	EmCacheMode                 string                   `json:"emCacheMode"`           // "shared", or "private" to give every job its own copy-on-write Emscripten cache
+	EmsdkPath                   string                   `json:"emsdkPath"`             // emsdk install mounted read-only into nsjail, e.g. /opt/emsdk
+	NodePath                    string                   `json:"nodePath"`              // node executable used by emcc inside nsjail
+	PythonPath                  string                   `json:"pythonPath"`            // python3 executable used by emcc inside nsjail
+	NsJailSeccompPolicy         string                   `json:"nsjailSeccompPolicy"`   // "default" for the built-in policy, or a kafel policy file; empty disables
+	NetworkPolicy               string                   `json:"networkPolicy"`         // "none", or "allowlist" to let requests opt into network access via the egress proxy
+	NetworkAllowlist            []string                 `json:"networkAllowlist"`      // Hosts reachable in allowlist mode; ".example.com" matches subdomains
+	NetworkProxyAddr            string                   `json:"networkProxyAddr"`      // Address the relay to the egress proxy listens on inside a network job's namespace
+	PortFetchTimeoutSecs        int                      `json:"portFetchTimeoutSecs"`  // Time added to the compile timeout of network jobs fetching uncached ports
+	CompileUID                  int                      `json:"compileUID"`            // User compiles run as; -1 runs them as the daemon's user
+	CompileGID                  int                      `json:"compileGID"`            // Group compiles run as; set together with compileUID
+	JobDirMode                  string                   `json:"jobDirMode"`            // Octal permissions of job dirs, e.g. "2770"
+	ArtifactDirMode             string                   `json:"artifactDirMode"`       // Octal permissions of published artifact dirs
+	ArtifactFileMode            string                   `json:"artifactFileMode"`      // Octal permissions of published artifact files
+	ArtifactUID                 int                      `json:"artifactUID"`           // Owner of published artifacts; -1 leaves it unchanged
+	ArtifactGID                 int                      `json:"artifactGID"`           // Group of published artifacts, e.g. the web server's; -1 leaves it unchanged
+	AllowUnsafe                 bool                     `json:"allowUnsafe"`           // Permit running compiles as root
+	LandlockEnabled             bool                     `json:"landlockEnabled"`       // Without nsjail, confine compiles to the job dir and toolchain with Landlock
+	CompileRetries              int                      `json:"compileRetries"`        // Times a build failing transiently (cache race, OOM) is retried
+	CompileRetryBackoffMs       int                      `json:"compileRetryBackoffMs"` // Delay before the first retry, doubled for each further one
+	MatrixMaxVariants           int                      `json:"matrixMaxVariants"`     // Arg sets one /matrix request may compile; 0 disables the endpoint
+	CompilerOutputMaxKB         int                      `json:"compilerOutputMaxKB"`   // Cap of each of a compile's stdout and stderr kept in memory
+	CompileNice                 int                      `json:"compileNice"`           // Nice value compile processes run at, 0 to 19
+	CompileIOClass              string                   `json:"compileIOClass"`        // I/O scheduling class of compile processes: "", "best-effort" or "idle"
+	MaxOutputMB                 int                      `json:"maxOutputMB"`           // Largest single file a build may publish; 0 disables
+	MaxOutputsTotalMB           int                      `json:"maxOutputsTotalMB"`     // Largest total a build may publish; 0 disables
+	MaxRequestKB                int                      `json:"maxRequestKB"`          // Largest compile, analyze or matrix request body, answered with 413 beyond; 0 disables
+	CompileTimeoutSecs          int                      `json:"compileTimeoutSecs"`    // Limit for one compile or analysis, also passed to nsjail --time_limit
+	SourceScanCommand           []string                 `json:"sourceScanCommand"`     // Scanner run on each submitted source, e.g. ["clamdscan", "--no-summary", "-"]; exit 1 rejects it
+	SourceScanURL               string                   `json:"sourceScanURL"`         // HTTP scanning service sources are posted to; 403 rejects them
+	ScanIncludes                bool                     `json:"scanIncludes"`          // Without nsjail, reject sources including files by absolute, parent-relative or computed paths
+	OverlayJobDirs              bool                     `json:"overlayJobDirs"`        // Mount job dirs as overlayfs over jobSkeletonDir with a tmpfs upper layer
+	JobSkeletonDir              string                   `json:"jobSkeletonDir"`        // Read-only lower layer of overlay job dirs, e.g. shared headers
+	JobScratchMB                int                      `json:"jobScratchMB"`          // Size cap of the tmpfs holding an overlay job dir's writes
+	CgroupV2Root                string                   `json:"cgroupV2Root"`
+	EnableResourceGating        bool                     `json:"enableResourceGating"`
+	JobMemoryEstimateMB         int64                    `json:"jobMemoryEstimateMB"`
+	MemPressureMaxAvg10         float64                  `json:"memPressureMaxAvg10"`  // Hold jobs while memory.pressure "some avg10" exceeds this percentage; 0 disables
+	AllowNodeEnvironment        bool                     `json:"allowNodeEnvironment"` // Permit -sENVIRONMENT=node in user args
+	AllowDynamicLinking         bool                     `json:"allowDynamicLinking"`  // Permit -sSIDE_MODULE= / -sMAIN_MODULE= in user args
+	SigningKeyFile              string                   `json:"signingKeyFile"`       // Ed25519 PKCS#8 PEM key signing the provenance of every build; empty disables
+	PostHooks                   []PostHook               `json:"postHooks"`            // Commands and URLs run on every successful build, in order
+	HeavyArgs                   map[string]*HeavyArg     `json:"heavyArgs"`            // Resource-hungry flags (e.g. -flto) permitted in user args, with the limits they get
+	TargetProfiles              map[string]TargetProfile `json:"targetProfiles"`       // Target runtimes requests may name in "profile"
+	AllowedFeatureFlags         []string                 `json:"allowedFeatureFlags"`  // Wasm target feature flags (e.g. -msimd128) permitted in user args
+	ClangTidyPath               string                   `json:"clangTidyPath"`
+	ClangTidyChecks             string                   `json:"clangTidyChecks"`      // Value of clang-tidy -checks=, e.g. "clang-analyzer-*,bugprone-*"
+	EmscriptenSysroot           string                   `json:"emscriptenSysroot"`    // Emscripten sysroot for analysis, e.g. <emsdk>/upstream/emscripten/cache/sysroot
+	WasmValidatorPath           string                   `json:"wasmValidatorPath"`    // wasm-validate run on produced modules when installed; empty skips it
+	WasmDisassemblerPath        string                   `json:"wasmDisassemblerPath"` // wasm2wat or wasm-dis, used for wat output
+	IdempotencyTTLHours         int                      `json:"idempotencyTTLHours"`  // How long responses are kept for Idempotency-Key replays; 0 disables
+	IdempotencyMaxKeys          int                      `json:"idempotencyMaxKeys"`   // Responses kept at most; the oldest are dropped first
+	IdempotencyMaxMB            int                      `json:"idempotencyMaxMB"`     // Total size of the response bodies kept at most
+	LoadShedEnabled             bool                     `json:"loadShedEnabled"`
+	ShedMaxQueueDepth           int                      `json:"shedMaxQueueDepth"`    // Max in-flight compiles before shedding; 0 disables
+	ShedMaxFailureRate          float64                  `json:"shedMaxFailureRate"`   // Max fraction of 5xx compiles within the window; 0 disables
+	ShedMaxMemoryPercent        int                      `json:"shedMaxMemoryPercent"` // Max cgroup memory.current as percent of memory.max; 0 disables
+	ShedAnonymousShare          float64                  `json:"shedAnonymousShare"`   // Share of each threshold at which anonymous callers are shed already
+	ShedWindowSecs              int                      `json:"shedWindowSecs"`
+	ShedRetryAfterSecs          int                      `json:"shedRetryAfterSecs"`
+	CompressResponses           bool                     `json:"compressResponses"`           // gzip/deflate API responses for clients accepting it
+	CompressMinBytes            int                      `json:"compressMinBytes"`            // Smaller responses are sent uncompressed
+	CompressContentTypes        []string                 `json:"compressContentTypes"`        // Media types eligible for compression
+	RequireAPIKey               bool                     `json:"requireAPIKey"`               // Require an API key from /admin/keys (or adminToken) for the API
+	APIKeysFile                 string                   `json:"apiKeysFile"`                 // Where API keys are persisted, under baseDir
+	EndpointRoles               map[string]string        `json:"endpointRoles"`               // Role ("anonymous", "user", "admin") each API path requires, e.g. "/matrix"
+	AnonymousCompileTimeoutSecs int                      `json:"anonymousCompileTimeoutSecs"` // Shorter compile limit for callers without credentials; 0 keeps compileTimeoutSecs
+	AdminToken                  string                   `json:"adminToken"`                  // Bearer token for /admin endpoints; empty disables them
+	OIDCIssuer                  string                   `json:"oidcIssuer"`                  // OIDC issuer whose JWTs are accepted as bearer tokens
+	OIDCAudience                string                   `json:"oidcAudience"`                // Audience the tokens must carry; empty accepts any
+	OIDCRolesClaim              string                   `json:"oidcRolesClaim"`              // Claim, possibly a dotted path, listing the caller's roles
+	OIDCAdminRole               string                   `json:"oidcAdminRole"`               // Role granting access to the /admin endpoints
+	DrainDelaySecs              int                      `json:"drainDelaySecs"`              // Time between POST /admin/drain failing readiness and the server shutting down
+	SelftestIntervalMins        int                      `json:"selftestIntervalMins"`        // How often the canary compile runs in the background; 0 disables it
+	AlertWebhookURL             string                   `json:"alertWebhookURL"`             // Generic webhook receiving operational alerts as JSON
+	AlertSlackWebhookURL        string                   `json:"alertSlackWebhookURL"`        // Slack incoming webhook receiving operational alerts
+	AlertMinIntervalMins        int                      `json:"alertMinIntervalMins"`        // Minimum time between two alerts for the same event
+	AlertMaxFailureRate         float64                  `json:"alertMaxFailureRate"`         // Alert when this fraction of requests fail with 5xx; 0 disables
+	AlertDiskMinFreeMB          int                      `json:"alertDiskMinFreeMB"`          // Alert when free space under baseDir drops below this; 0 disables
 }
 
 // CompileRequest represents the request payload for compilation
 type CompileRequest struct {
-	Code string   `json:"code"`
-	Type string   `json:"type"` // "c" or "cpp"
-	Args []string `json:"args"`
+	Code           string            `json:"code"`
+	Type           string            `json:"type"` // "c" or "cpp"
+	Args           []string          `json:"args"`
+	Defines        map[string]string `json:"defines,omitempty"`        // Preprocessor defines; an empty value gives -DNAME
+	IncludeDirs    []string          `json:"includeDirs,omitempty"`    // Include paths relative to the job directory
+	Cache          string            `json:"cache,omitempty"`          // "shared" (default) or "private" for a copy of the Emscripten cache used by this job alone
+	Network        bool              `json:"network,omitempty"`        // Allow downloads through the egress proxy, e.g. emscripten ports
+	Warnings       string            `json:"warnings,omitempty"`       // "none", "default", "all" or "error"
+	WAT            bool              `json:"wat,omitempty"`            // Also publish the text-format disassembly of app.wasm
+	SeparateDebug  bool              `json:"separateDebug,omitempty"`  // Move DWARF debug info out of app.wasm into app.debug.wasm
+	SizeReport     bool              `json:"sizeReport,omitempty"`     // Include a section/function size breakdown of app.wasm
+	Preview        bool              `json:"preview,omitempty"`        // Publish the html build under a live preview route that reloads on rebuilds
+	PreviewID      string            `json:"previewId,omitempty"`      // Preview to update, from an earlier response; a new one is created otherwise
+	Alias          string            `json:"alias,omitempty"`          // Stable name to also publish the artifacts under; requires an authenticated caller
+	TTLHours       int               `json:"ttlHours,omitempty"`       // How long to keep the artifacts, instead of artifactTTLDays
+	Profile        string            `json:"profile,omitempty"`        // Target runtime from targetProfiles, e.g. "safari16"
+	Output         string            `json:"output,omitempty"`         // "wasm" (default), "html", "object", "staticlib", "preprocessed", "asm" or "llvm-ir"
+	IdempotencyKey string            `json:"idempotencyKey,omitempty"` // Alternative to the Idempotency-Key header
 }
 
 // CompileResponse represents the response from compilation
 type CompileResponse struct {
-	OK    bool   `json:"ok"`
-	ID    string `json:"id"`
-	JS    string `json:"js"`
-	WASM  string `json:"wasm"`
-	Error string `json:"error,omitempty"`
+	OK      bool   `json:"ok"`
+	ID      string `json:"id"`
+	TraceID string `json:"traceId,omitempty"` // W3C trace ID the request was handled under
+	JS      string `json:"js"`                // empty for side modules and non-wasm outputs
+	WASM    string `json:"wasm"`
+	WAT     string `json:"wat,omitempty"`   // set when the request asked for wat
+	Debug   string `json:"debug,omitempty"` // debug info split off app.wasm, with separateDebug
+	Error   string `json:"error,omitempty"`
+	// The compiler's output streams, each capped at compilerOutputMaxKB
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	Log    string `json:"log,omitempty"` // URL of the retained compiler output
+	// The arguments the compiler ran with, and the requested ones the allowlist dropped
+	ArgsUsed     []string      `json:"argsUsed,omitempty"`
+	ArgsRejected []RejectedArg `json:"argsRejected,omitempty"`
+	// URL the artifacts are also served under by the requested alias
+	Alias string `json:"alias,omitempty"`
+	// When the artifacts are cleaned up; absent when they are kept indefinitely
+	Expires time.Time `json:"expires,omitzero"`
+	Retries int       `json:"retries,omitempty"` // attempts repeated after transient toolchain failures
+	// Time spent waiting for a build slot under resource gating, and building, retries included
+	QueuedMs  int64 `json:"queuedMs"`
+	CompileMs int64 `json:"compileMs"`
+	// Lifecycle of the job: received, queued, gate-acquired, sandbox-started and
+	// compiler-exited for every attempt, artifacts-published
+	Events []JobEvent `json:"events,omitempty"`
+	// Output mode of the build and, for non-wasm outputs, the URL of the produced file
+	Output   string `json:"output,omitempty"`
+	Artifact string `json:"artifact,omitempty"`
+	// Every published file by name, including extras such as .data, .worker.js or .map
+	Files map[string]string `json:"files,omitempty"`
+	// Number of warnings and errors the compiler reported
+	Diagnostics DiagnosticCounts `json:"diagnostics"`
+	// Set when the request asked for a size report
+	SizeReport *SizeReport `json:"sizeReport,omitempty"`
+	// Wasm target features enabled for the build, e.g. ["simd128", "bulk-memory"]
+	Features []string `json:"features,omitempty"`
+	// Page of the live preview the build was published to, and its ID
+	Preview   string `json:"preview,omitempty"`
+	PreviewID string `json:"previewId,omitempty"`
+	// The target profile the request named, resolved
+	Profile *ResolvedProfile `json:"profile,omitempty"`
+}
+
+// Example is a server-managed example program
+type Example struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`                  // "c" or "cpp", from the file extension
+	Description string `json:"description,omitempty"` // leading // comment of the file
+	Code        string `json:"code,omitempty"`        // omitted in listings
+}
+
+// MatrixRequest is a compile request built once per arg set in variants; the
+// variant's args are appended to args
+type MatrixRequest struct {
+	CompileRequest
+	Variants [][]string `json:"variants"`
+}
+
+// MatrixResponse compares the builds of a MatrixRequest
+type MatrixResponse struct {
+	Results []MatrixResult `json:"results"` // in the order of the variants
+	// Indexes of the successful variants with the fewest artifact bytes and the
+	// shortest compile; -1 when none succeeded
+	Smallest int `json:"smallest"`
+	Fastest  int `json:"fastest"`
+}
+
+// MatrixResult is the build of one variant
+type MatrixResult struct {
+	Args       []string         `json:"args"`
+	Result     CompileResponse  `json:"result"`
+	Sizes      map[string]int64 `json:"sizes,omitempty"` // bytes of every published file
+	TotalBytes int64            `json:"totalBytes"`
+}
+
+// HeavyArg is the time and memory a compile using a resource-hungry flag is
+// granted instead of the defaults
+type HeavyArg struct {
+	TimeoutSecs      int     `json:"timeoutSecs"`      // replaces compileTimeoutSecs when longer
+	MemoryMultiplier float64 `json:"memoryMultiplier"` // scales jobMemoryEstimateMB at admission
+}
+
+// PostHook is a step run on every successful build: a command run like the compile
+// in the job directory before publishing, or a URL notified after it
+type PostHook struct {
+	Name        string   `json:"name"`
+	Command     []string `json:"command,omitempty"`   // run with the names of the build's outputs appended
+	URL         string   `json:"url,omitempty"`       // POSTed a PostHookEvent
+	TimeoutSecs int      `json:"timeoutSecs"`         // 0 means 60
+	OnFailure   string   `json:"onFailure,omitempty"` // "fail" (default) fails the job, "ignore" only logs
+}
+
+// Provenance records how a build was made; signed builds publish it as
+// provenance.json with an Ed25519 signature in provenance.json.sig
+type Provenance struct {
+	ID        string            `json:"id"`
+	Created   time.Time         `json:"created"`
+	Toolchain string            `json:"toolchain"` // first line of the compiler's --version
+	Argv      []string          `json:"argv"`      // the compile command, source file and forced flags included
+	Files     map[string]string `json:"files"`     // output name to SHA-256, hex-encoded
+}
+
+// ArtifactManifest describes a build to whoever finds its artifact directory; every
+// build publishes it as meta.json
+type ArtifactManifest struct {
+	ID        string            `json:"id"`
+	Created   time.Time         `json:"created"`
+	Output    string            `json:"output"`             // output mode of the build
+	Args      []string          `json:"args"`               // the arguments the compiler ran with, as in argsUsed
+	Toolchain string            `json:"toolchain"`          // first line of the compiler's --version
+	Files     map[string]string `json:"files"`              // output name to SHA-256, hex-encoded
+	TTLHours  int               `json:"ttlHours,omitempty"` // set when the request chose its own TTL
+	Expires   time.Time         `json:"expires,omitzero"`   // when the artifacts are cleaned up; absent when kept indefinitely
+}
+
+// PostHookEvent is what URL post hooks receive about a published build
+type PostHookEvent struct {
+	ID    string            `json:"id"`
+	Files map[string]string `json:"files"` // file name to URL
+}
+
+// TargetProfile maps a target browser or runtime to the emcc settings for it and
+// the wasm features (names as in -m<feature>) it supports
+type TargetProfile struct {
+	Args     []string `json:"args"`
+	Features []string `json:"features"`
+}
+
+// ResolvedProfile is the target profile a compile used
+type ResolvedProfile struct {
+	Name     string   `json:"name"`
+	Args     []string `json:"args"`
+	Features []string `json:"features"`
+}
+
+// RejectedArg is a requested compiler argument that was dropped, and why
+type RejectedArg struct {
+	Arg    string `json:"arg"`
+	Reason string `json:"reason"`
+}
+
+// Share is a build stored under a permalink: the compile request, optionally with
+// the artifacts it produced
+type Share struct {
+	CompileRequest
+	ArtifactID string    `json:"artifactId,omitempty"` // ID of a compile whose artifacts to link
+	Slug       string    `json:"slug"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	// URLs of the linked artifacts while they have not expired
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// AnalyzeRequest represents the request payload for static analysis
+type AnalyzeRequest struct {
+	Code string `json:"code"`
+	Type string `json:"type"` // "c" or "cpp"
+}
+
+// AnalyzeResponse represents the response from static analysis
+type AnalyzeResponse struct {
+	OK       bool      `json:"ok"`
+	ID       string    `json:"id"`
+	TraceID  string    `json:"traceId,omitempty"`
+	Findings []Finding `json:"findings"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Finding is a single clang-tidy diagnostic
+type Finding struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"` // "warning", "error" or "note"
+	Message  string `json:"message"`
+	Check    string `json:"check,omitempty"`
+}
+
+// JobEvent is one step in the lifecycle of a job
+type JobEvent struct {
+	Event    string    `json:"event"`
+	At       time.Time `json:"at"`
+	OffsetMs int64     `json:"offsetMs"` // time since the request was received
+}
+
+// DiagnosticCounts tallies compiler diagnostics by severity
+type DiagnosticCounts struct {
+	Warnings int `json:"warnings"`
+	Errors   int `json:"errors"`
+}
+
+// ErrorResponse is the body of every error response other than a failed build
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIError describes why a request failed
+type APIError struct {
+	Code    string `json:"code"` // stable machine-readable reason, e.g. "invalid_field"
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"` // request field that failed validation
+	// Load when a compile was shed, for informed backoff
+	Queue *QueueState `json:"queue,omitempty"`
+}
+
+// QueueState is the load an overloaded server reports with its 503
+type QueueState struct {
+	Depth           int     `json:"depth"`                     // compiles in flight
+	MaxDepth        int     `json:"maxDepth,omitempty"`        // shedMaxQueueDepth, when set
+	CompletedPerMin float64 `json:"completedPerMin,omitempty"` // throughput over shedWindowSecs
+	AvgDurationMs   int64   `json:"avgDurationMs,omitempty"`   // of the compiles finished within it
+	EstimatedWaitMs int64   `json:"estimatedWaitMs,omitempty"` // until a slot is likely free
+	RetryAfterSecs  int     `json:"retryAfterSecs"`            // as sent in Retry-After
+}
+
+// ArtifactStatus is the payload of /admin/artifacts/{id}/pin
+type ArtifactStatus struct {
+	ID     string `json:"id"`
+	Pinned bool   `json:"pinned"`
+	// When the artifact is cleaned up once unpinned; absent when never
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// ChannelRelease is an artifact promoted to a release channel
+type ChannelRelease struct {
+	ArtifactID string    `json:"artifactId"`
+	Promoted   time.Time `json:"promoted"`
+}
+
+// ChannelStatus is the payload of /admin/channels/{name}
+type ChannelStatus struct {
+	Name    string           `json:"name"`
+	Current string           `json:"current"` // artifact served under url
+	URL     string           `json:"url"`
+	History []ChannelRelease `json:"history"` // newest first, current included
+}
+
+// APIKey describes an API key; Key, the secret, is only returned on creation
+type APIKey struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Key     string    `json:"key,omitempty"`
+}
+
+// AdminStats is the payload of GET /admin/stats
+type AdminStats struct {
+	InflightJobs int             `json:"inflightJobs"`
+	Draining     bool            `json:"draining"`
+	Ccache       *CcacheStats    `json:"ccache,omitempty"`   // set when ccacheDir is configured
+	Selftest     *SelftestResult `json:"selftest,omitempty"` // the last self-test, if one ran
+}
+
+// SelftestResult is the outcome of compiling the canary program
+type SelftestResult struct {
+	OK         bool      `json:"ok"`
+	Time       time.Time `json:"time"`
+	DurationMs int64     `json:"durationMs"`
+	JobID      string    `json:"jobId,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// CcacheStats summarizes the compiler cache counters
+type CcacheStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+	// Every counter ccache --print-stats reports, by name
+	Counters map[string]int64 `json:"counters"`
+}
+
+// SizeReport breaks down where the bytes of a compiled module go
+type SizeReport struct {
+	WasmBytes int           `json:"wasmBytes"`
+	JSBytes   int64         `json:"jsBytes,omitempty"`
+	Sections  []SectionSize `json:"sections"`
+	// Largest function bodies first; names need a name section (e.g. built with -g)
+	Functions []FunctionSize `json:"functions,omitempty"`
+}
+
+// SectionSize is the payload size of one wasm section
+type SectionSize struct {
+	Name  string `json:"name"` // section kind, or the name of a custom section
+	Bytes int    `json:"bytes"`
+}
+
+// FunctionSize is the body size of one wasm function
+type FunctionSize struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	Bytes int    `json:"bytes"`
 }
@@ -0,0 +1,97 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// validateOutputs checks the modules and JS loaders a build produced before they are
+// published, so truncated or corrupted files are reported instead of served
+func (s *Server) validateOutputs(ctx context.Context, jobDir string, outputs []string) error {
+	for _, name := range outputs {
+		var err error
+		switch filepath.Ext(name) {
+		case ".wasm":
+			err = s.validateWasmFile(ctx, jobDir, name)
+		case ".js":
+			err = validateJSFile(filepath.Join(jobDir, name))
+		}
+		if err != nil {
+			return fmt.Errorf("invalid output %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateWasmFile runs the built-in structural check and, if installed, wasm-validate
+func (s *Server) validateWasmFile(ctx context.Context, jobDir, name string) error {
+	b, err := os.ReadFile(filepath.Join(jobDir, name))
+	if err != nil {
+		return err
+	}
+	if err := validateWasm(b); err != nil {
+		return err
+	}
+	if s.cfg.WasmValidatorPath == "" {
+		return nil
+	}
+	if _, err := exec.LookPath(s.cfg.WasmValidatorPath); err != nil {
+		return nil // optional; the built-in check already ran
+	}
+	cmd, err := s.compileCommand(ctx, jobDir, []string{s.cfg.WasmValidatorPath, "--enable-all", name}, false)
+	if err != nil {
+		return err
+	}
+	if out, err := s.runLogged(cmd, nil); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return errors.New(strings.TrimSpace(string(out.combined())))
+		}
+		return err
+	}
+	return nil
+}
+
+// validateJSFile applies basic sanity checks to a generated JS loader
+func validateJSFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(bytes.TrimSpace(b)) == 0:
+		return errors.New("empty file")
+	case !utf8.Valid(b):
+		return errors.New("not valid UTF-8")
+	case bytes.IndexByte(b, 0) >= 0:
+		return errors.New("contains NUL bytes")
+	}
+	return nil
+}
+
+// checkOutputSizes enforces maxOutputMB on each output and maxOutputsTotalMB on
+// all of them together, so one build cannot fill the artifact store
+func (s *Server) checkOutputSizes(jobDir string, outputs []string) error {
+	var total int64
+	for _, name := range outputs {
+		fi, err := os.Stat(filepath.Join(jobDir, name))
+		if err != nil {
+			return err
+		}
+		if s.cfg.MaxOutputMB > 0 && fi.Size() > int64(s.cfg.MaxOutputMB)<<20 {
+			return fmt.Errorf("output too large: %s is %.1f MB, the limit is %d MB", name, float64(fi.Size())/(1<<20), s.cfg.MaxOutputMB)
+		}
+		total += fi.Size()
+	}
+	if s.cfg.MaxOutputsTotalMB > 0 && total > int64(s.cfg.MaxOutputsTotalMB)<<20 {
+		return fmt.Errorf("output too large: the build produced %.1f MB, the limit is %d MB", float64(total)/(1<<20), s.cfg.MaxOutputsTotalMB)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package src
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiVersion is the version of the HTTP API served under /v1
+const apiVersion = "1"
+
+// apiVersionHeader lets clients name the API version they were written against
+const apiVersionHeader = "API-Version"
+
+// withAPIVersion rejects requests asking for an API version this server does not
+// speak and reports the version that answered
+func withAPIVersion(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if v := strings.TrimPrefix(strings.TrimSpace(r.Header.Get(apiVersionHeader)), "v"); v != "" && v != apiVersion {
+			writeError(w, http.StatusBadRequest, codeUnsupportedVersion, "", "unsupported API version "+v+"; this server speaks "+apiVersion)
+			return
+		}
+		w.Header().Set(apiVersionHeader, apiVersion)
+		next(w, r)
+	}
+}
+
+// deprecatedAlias serves a legacy unversioned path, pointing clients at its successor under /v1
+func (s *Server) deprecatedAlias(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+s.publicURL(r, "/v"+apiVersion+r.URL.Path)+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
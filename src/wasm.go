@@ -0,0 +1,321 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// wasmMagic is the preamble of every binary wasm module (magic + version 1)
+var wasmMagic = []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+
+// wasmSectionNames maps known section ids to their names
+var wasmSectionNames = map[byte]string{
+	0: "custom", 1: "type", 2: "import", 3: "function", 4: "table", 5: "memory",
+	6: "global", 7: "export", 8: "start", 9: "element", 10: "code", 11: "data",
+	12: "datacount", 13: "tag",
+}
+
+// maxReportedFunctions bounds the function list in size reports
+const maxReportedFunctions = 10
+
+// wasmSection is one top-level section of a module
+type wasmSection struct {
+	id   byte
+	name string // custom section name, or the section kind
+	body []byte
+}
+
+// parseWasmSections splits a binary module into its sections, checking framing only
+func parseWasmSections(b []byte) ([]wasmSection, error) {
+	if !bytes.HasPrefix(b, wasmMagic) {
+		return nil, errors.New("not a wasm module (bad magic or version)")
+	}
+	r := &wasmReader{b: b, pos: len(wasmMagic)}
+	var sections []wasmSection
+	for r.pos < len(r.b) {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.uleb()
+		if err != nil {
+			return nil, err
+		}
+		body, err := r.bytes(size)
+		if err != nil {
+			return nil, fmt.Errorf("section %d truncated: %w", id, err)
+		}
+		sec := wasmSection{id: id, name: wasmSectionNames[id], body: body}
+		if sec.name == "" {
+			return nil, fmt.Errorf("unknown section id %d", id)
+		}
+		if id == 0 {
+			cr := &wasmReader{b: body}
+			name, err := cr.name()
+			if err != nil {
+				return nil, fmt.Errorf("custom section name: %w", err)
+			}
+			sec.name = name
+		}
+		sections = append(sections, sec)
+	}
+	return sections, nil
+}
+
+// wasmSectionOrder is the position each non-custom section must appear in
+var wasmSectionOrder = map[byte]int{
+	1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 13: 6, 6: 7, 7: 8, 8: 9, 9: 10, 12: 11, 10: 12, 11: 13,
+}
+
+// validateWasm checks the structure of a module beyond framing: section order, no
+// duplicate sections, and one well-formed code body per declared function
+func validateWasm(b []byte) error {
+	sections, err := parseWasmSections(b)
+	if err != nil {
+		return err
+	}
+	last := 0
+	declared, bodies := 0, 0
+	for _, sec := range sections {
+		if sec.id == 0 {
+			continue
+		}
+		pos := wasmSectionOrder[sec.id]
+		if pos <= last {
+			return fmt.Errorf("%s section out of order or duplicated", sec.name)
+		}
+		last = pos
+		switch sec.id {
+		case 3:
+			r := &wasmReader{b: sec.body}
+			if declared, err = r.uleb(); err != nil {
+				return fmt.Errorf("function section: %w", err)
+			}
+		case 10:
+			sizes, err := functionBodySizes(sec.body)
+			if err != nil {
+				return fmt.Errorf("code section: %w", err)
+			}
+			bodies = len(sizes)
+		}
+	}
+	if declared != bodies {
+		return fmt.Errorf("%d functions declared but %d bodies present", declared, bodies)
+	}
+	return nil
+}
+
+// buildSizeReport summarizes section sizes and the largest function bodies of a module
+func buildSizeReport(b []byte) (*SizeReport, error) {
+	sections, err := parseWasmSections(b)
+	if err != nil {
+		return nil, err
+	}
+	report := &SizeReport{WasmBytes: len(b)}
+	var importedFuncs int
+	var bodies []int
+	names := map[int]string{}
+	for _, sec := range sections {
+		report.Sections = append(report.Sections, SectionSize{Name: sec.name, Bytes: len(sec.body)})
+		switch {
+		case sec.id == 2:
+			if importedFuncs, err = countFunctionImports(sec.body); err != nil {
+				return nil, fmt.Errorf("import section: %w", err)
+			}
+		case sec.id == 10:
+			if bodies, err = functionBodySizes(sec.body); err != nil {
+				return nil, fmt.Errorf("code section: %w", err)
+			}
+		case sec.id == 0 && sec.name == "name":
+			// names are optional debug info; ignore a malformed section
+			names = functionNames(sec.body)
+		}
+	}
+	for i, size := range bodies {
+		idx := importedFuncs + i
+		report.Functions = append(report.Functions, FunctionSize{Index: idx, Name: names[idx], Bytes: size})
+	}
+	sort.SliceStable(report.Functions, func(i, j int) bool {
+		return report.Functions[i].Bytes > report.Functions[j].Bytes
+	})
+	if len(report.Functions) > maxReportedFunctions {
+		report.Functions = report.Functions[:maxReportedFunctions]
+	}
+	return report, nil
+}
+
+// countFunctionImports returns how many entries of an import section are functions
+func countFunctionImports(body []byte) (int, error) {
+	r := &wasmReader{b: body}
+	n, err := r.uleb()
+	if err != nil {
+		return 0, err
+	}
+	funcs := 0
+	for i := 0; i < n; i++ {
+		if _, err := r.name(); err != nil {
+			return 0, err
+		}
+		if _, err := r.name(); err != nil {
+			return 0, err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		switch kind {
+		case 0: // func: type index
+			funcs++
+			_, err = r.uleb()
+		case 1: // table: reftype + limits
+			if _, err = r.byte(); err == nil {
+				err = r.limits()
+			}
+		case 2: // memory: limits
+			err = r.limits()
+		case 3: // global: valtype + mutability
+			_, err = r.bytes(2)
+		case 4: // tag: attribute + type index
+			if _, err = r.byte(); err == nil {
+				_, err = r.uleb()
+			}
+		default:
+			return 0, fmt.Errorf("unknown import kind %d", kind)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return funcs, nil
+}
+
+// functionBodySizes returns the size in bytes of every body in a code section
+func functionBodySizes(body []byte) ([]int, error) {
+	r := &wasmReader{b: body}
+	n, err := r.uleb()
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		size, err := r.uleb()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.bytes(size); err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// functionNames reads the function name map of a "name" custom section
+func functionNames(body []byte) map[int]string {
+	names := map[int]string{}
+	r := &wasmReader{b: body}
+	if _, err := r.name(); err != nil { // the custom section's own name
+		return names
+	}
+	for r.pos < len(r.b) {
+		id, err := r.byte()
+		if err != nil {
+			return names
+		}
+		size, err := r.uleb()
+		if err != nil {
+			return names
+		}
+		sub, err := r.bytes(size)
+		if err != nil || id != 1 { // 1 = function names
+			continue
+		}
+		sr := &wasmReader{b: sub}
+		n, err := sr.uleb()
+		if err != nil {
+			return names
+		}
+		for i := 0; i < n; i++ {
+			idx, err := sr.uleb()
+			if err != nil {
+				return names
+			}
+			name, err := sr.name()
+			if err != nil {
+				return names
+			}
+			names[idx] = name
+		}
+	}
+	return names
+}
+
+// wasmReader decodes the primitive encodings used by the binary format
+type wasmReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *wasmReader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, errors.New("unexpected end of data")
+	}
+	c := r.b[r.pos]
+	r.pos++
+	return c, nil
+}
+
+func (r *wasmReader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.b)-r.pos {
+		return nil, errors.New("unexpected end of data")
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// uleb reads an unsigned LEB128 value of at most 32 bits
+func (r *wasmReader) uleb() (int, error) {
+	var v uint64
+	for shift := 0; shift < 35; shift += 7 {
+		c, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			if v > 1<<32-1 {
+				break
+			}
+			return int(v), nil
+		}
+	}
+	return 0, errors.New("malformed LEB128 integer")
+}
+
+// name reads a length-prefixed UTF-8 string
+func (r *wasmReader) name() (string, error) {
+	n, err := r.uleb()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(n)
+	return string(b), err
+}
+
+// limits skips a table or memory limits entry
+func (r *wasmReader) limits() error {
+	flags, err := r.byte()
+	if err != nil {
+		return err
+	}
+	if _, err := r.uleb(); err != nil {
+		return err
+	}
+	if flags&0x01 != 0 {
+		_, err = r.uleb()
+	}
+	return err
+}
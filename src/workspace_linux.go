@@ -0,0 +1,93 @@
+//go:build linux
+
+package src
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// mountJobOverlay mounts an overlay at jobDir with skeleton as the read-only lower
+// layer; the writable upper layer lives on a tmpfs capped at sizeMB, so writes are
+// bounded and vanish with the mount
+func mountJobOverlay(jobDir, skeleton string, sizeMB int) error {
+	lower, err := filepath.Abs(skeleton)
+	if err != nil {
+		return err
+	}
+	scratch := jobDir + ".scratch"
+	if err := os.MkdirAll(scratch, 0o755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(jobDir, 0o755); err != nil {
+		return err
+	}
+	opts := fmt.Sprintf("size=%dm,mode=0755", sizeMB)
+	if err := syscall.Mount("tmpfs", scratch, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, opts); err != nil {
+		os.Remove(scratch)
+		os.Remove(jobDir)
+		return fmt.Errorf("mount job scratch tmpfs: %w", err)
+	}
+	upper := filepath.Join(scratch, "upper")
+	work := filepath.Join(scratch, "work")
+	err = os.Mkdir(upper, 0o755)
+	if err == nil {
+		err = os.Mkdir(work, 0o755)
+	}
+	if err == nil {
+		opts = fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lower, upper, work)
+		if err = syscall.Mount("overlay", jobDir, "overlay", syscall.MS_NOSUID|syscall.MS_NODEV, opts); err != nil {
+			err = fmt.Errorf("mount job overlay: %w", err)
+		}
+	}
+	if err != nil {
+		_ = syscall.Unmount(scratch, syscall.MNT_DETACH)
+		os.Remove(scratch)
+		os.Remove(jobDir)
+		return err
+	}
+	return nil
+}
+
+// unmountJobOverlay detaches the overlay and scratch tmpfs created by mountJobOverlay
+func unmountJobOverlay(jobDir string) error {
+	scratch := jobDir + ".scratch"
+	if err := syscall.Unmount(jobDir, syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmount job overlay: %w", err)
+	}
+	if err := syscall.Unmount(scratch, syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmount job scratch tmpfs: %w", err)
+	}
+	return os.Remove(scratch)
+}
+
+// tmpfsMagic is the filesystem type statfs reports for tmpfs
+const tmpfsMagic = 0x01021994
+
+// mountJobsTmpfs mounts a tmpfs capped at sizeMB on dir unless dir already is one;
+// it reports whether a new mount was made
+func mountJobsTmpfs(dir string, sizeMB int) (bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return false, err
+	}
+	if st.Type == tmpfsMagic {
+		return false, nil
+	}
+	opts := fmt.Sprintf("size=%dm,mode=0755", sizeMB)
+	if err := syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, opts); err != nil {
+		return false, fmt.Errorf("mount tmpfs on %s: %w", dir, err)
+	}
+	return true, nil
+}
+
+// diskFreeBytes returns the space available to unprivileged users on the filesystem holding path
+func diskFreeBytes(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * st.Bsize, nil
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package src
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// mountJobOverlay is unavailable outside Linux; overlayfs is a Linux filesystem
+func mountJobOverlay(jobDir, skeleton string, sizeMB int) error {
+	return fmt.Errorf("overlay job directories are not available on %s", runtime.GOOS)
+}
+
+// unmountJobOverlay is unavailable outside Linux
+func unmountJobOverlay(jobDir string) error {
+	return fmt.Errorf("overlay job directories are not available on %s", runtime.GOOS)
+}
+
+// mountJobsTmpfs is unavailable outside Linux
+func mountJobsTmpfs(dir string, sizeMB int) (bool, error) {
+	return false, fmt.Errorf("tmpfs is not available on %s", runtime.GOOS)
+}
+
+// diskFreeBytes is not implemented outside Linux
+func diskFreeBytes(path string) (int64, error) {
+	return 0, fmt.Errorf("disk space check is not available on %s", runtime.GOOS)
+}